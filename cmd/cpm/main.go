@@ -0,0 +1,624 @@
+// cmd/cpm is the command line front end of the cpm package: it parses
+// the flags, reads the graph files and writes the result. See the
+// comments at the top of cpm.go for the theory of operation and the
+// Model Graph.
+//
+// BUILD INSTRUCTIONS:
+//     go build ./cmd/cpm
+//
+// RUN INSTRUCTIONS:
+//     ./cpm [-k=int] [-dump-intermediate=dir] graphFileDef
+
+package main
+
+import "fmt"
+import "flag"
+import "os"
+import "strings"
+import "strconv"
+import "encoding/json"
+
+import "github.com/jonrobin3/cpm"
+
+// the database/sql driver for -sqlite
+import _ "modernc.org/sqlite"
+
+func main() {
+    var graph []*cpm.GraphNode
+    
+    // Process command line args
+    k := flag.Int("k", 3, "the size of k-clique")
+    dump_dir := flag.String("dump-intermediate", "",
+        "write every pipeline artifact to its own file in this directory")
+    informat := flag.String("informat", "colon",
+        "input format of the graph file: colon, colon2 (two passes; bounded memory only for regular files, not stdin or tar), leda, csv, json, tar, tgf or gob")
+    outformat := flag.String("outformat", "text",
+        "output format: text, bipartite, mtx, membership, ndjson, nmi, onehot, md, dot or json")
+    flag.StringVar(outformat, "format", "text", "same as -outformat")
+    explain_id := flag.Int("explain-community", 0,
+        "print the chain of cliques that percolates this community id")
+    var limits cpm.Limits
+    flag.IntVar(&limits.MaxNodes, "max-nodes", 0,
+        "refuse graphs with more nodes than this (0 is unlimited)")
+    flag.IntVar(&limits.MaxEdges, "max-edges", 0,
+        "refuse graphs with more edges than this (0 is unlimited)")
+    flag.IntVar(&limits.MaxCliques, "max-cliques", 0,
+        "stop after finding more cliques than this (0 is unlimited)")
+    flag.IntVar(&limits.MaxCandidates, "max-candidates", 0,
+        "refuse graphs whose -estimate exceeds this (0 is unlimited)")
+    flag.DurationVar(&limits.MaxDuration, "max-duration", 0,
+        "stop the clique search after this long, e.g. 30s (0 is unlimited)")
+    sqlite_filename := flag.String("sqlite", "",
+        "write nodes, edges, cliques and communities to this SQLite database")
+    degenerate_check := flag.Bool("degenerate-check", false,
+        "re-verify that every clique found is complete in both directions")
+    merge_threshold := flag.Float64("merge-threshold", 0,
+        "merge communities whose Jaccard similarity exceeds this (0 disables)")
+    intensity := flag.Float64("w", 0,
+        "CPMw: only use cliques whose intensity exceeds this (0 disables)")
+    force_connected := flag.Bool("force-connected", false,
+        "connect all components through a virtual hub vertex")
+    list_triangles := flag.Bool("triangles", false,
+        "list every triangle (3-clique) with the fast triangle lister and exit")
+    community_dot_dir := flag.String("community-dot", "",
+        "write a DOT file of each community's induced subgraph to this directory")
+    show_weights := flag.Bool("show-weights", false,
+        "print edge weights in the original graph, e.g. v1: v2(0.8)")
+    show_vertex_weight := flag.Bool("show-vertex-weight", false,
+        "print the total vertex weight of each community")
+    drop_contained := flag.Bool("drop-contained", false,
+        "drop cliques whose vertices are a subset of a larger clique")
+    ascii := flag.Bool("ascii", false,
+        "draw a small community graph as ASCII art")
+    repeatable := flag.Bool("repeatable", false,
+        "sort everything canonically for byte-identical output")
+    show_conductance := flag.Bool("show-conductance", false,
+        "print the conductance of each community")
+    verbose := flag.Bool("v", false,
+        "verbose: report diagnostics, such as the slowest nodes, on stderr")
+    checkpoint := flag.String("checkpoint", "",
+        "periodically save the clique search state to this file")
+    checkpoint_every := flag.Int("checkpoint-every", 1000,
+        "number of examination nodes between checkpoints")
+    resume := flag.String("resume", "",
+        "resume the clique search from this checkpoint file")
+    index_map_filename := flag.String("index-map", "",
+        "write the label<TAB>index vertex numbering to this file")
+    algo := flag.String("algo", "auto",
+        "clique search algorithm: auto (by density), candidates or bk (Bron-Kerbosch); gn runs Girvan-Newman instead of CPM")
+    partitions := flag.Int("partitions", 2,
+        "number of communities for -algo gn")
+    compare_algos := flag.Bool("compare-algos", false,
+        "check that -algo candidates and bk find the same k-cliques, print pass or FAIL, and exit")
+    top_communities := flag.Int("top-communities", 0,
+        "list only the N largest communities")
+    weight_quantiles := flag.Bool("weight-quantiles", false,
+        "print the min, quartiles and max of the edge weights and exit")
+    lcc := flag.Bool("lcc", false,
+        "run CPM on the largest connected component only")
+    stats := flag.Bool("stats", false,
+        "print graph statistics (density, clustering coefficient) and exit")
+    cliques_by_size_dir := flag.String("cliques-by-size", "",
+        "write the cliques of each size from k up to this directory")
+    merge_isolated := flag.Bool("merge-isolated", false,
+        "add each uncovered vertex to the community with most of its neighbors")
+    fingerprint := flag.Bool("fingerprint", false,
+        "print a SHA-256 fingerprint of the result")
+    explain_uncovered := flag.Bool("explain-uncovered", false,
+        "print why each vertex in no community is uncovered")
+    top_bridges := flag.Int("bridges", 0,
+        "print the N vertices that bridge the most community pairs")
+    require_weights := flag.Bool("require-weights", false,
+        "with -w, refuse input that has edges without an explicit weight")
+    mixed_k := flag.String("mixed-k", "",
+        "comma separated clique sizes to percolate together, e.g. 3,4")
+    min_overlap := flag.Int("min-overlap", 0,
+        "vertices two k-cliques must share to percolate, 1 to k-1 (default k-1)")
+    save_gob := flag.String("save-gob", "",
+        "save the parsed graph to this file for fast reloading with -informat gob")
+    highlight := flag.String("highlight", "",
+        "comma separated vertices to highlight in DOT output, e.g. v5,v9")
+    show_density := flag.Bool("show-density", false,
+        "print the internal edge density of each community")
+    canonicalize := flag.Bool("canonicalize", false,
+        "rewrite the graph definition files in canonical form and exit")
+    sample_cliques := flag.Int("sample-cliques", 0,
+        "print N k-cliques sampled uniformly at random and exit")
+    seed := flag.Int64("seed", 1, "random seed for -sample-cliques")
+    validate_k_range := flag.String("validate-k-range", "",
+        "run every k in the range LO-HI, score each by -criterion and report the best")
+    criterion := flag.String("criterion", "modularity",
+        "-validate-k-range score: modularity, coverage or count")
+    prune_leaves := flag.Bool("prune-leaves", false,
+        "repeatedly remove vertices of degree 1 before the clique search (k >= 3)")
+    stop_at_first := flag.Bool("stop-at-first-community", false,
+        "print whether any k-community exists, stopping at the first k-clique found, and exit")
+    transpose := flag.Bool("transpose", false,
+        "reverse every edge of the graph before anything else is done")
+    serve := flag.String("serve", "",
+        "serve CPM over HTTP on this address, e.g. :8080, instead of reading graph files")
+    max_request_bytes := flag.Int64("max-request-bytes", 64 << 20,
+        "largest graph -serve accepts in a request body")
+    nodes_filename := flag.String("nodes", "",
+        "CSV list of vertices, label[,weight]; used with -edges")
+    edges_filename := flag.String("edges", "",
+        "CSV list of edges, source,target[,weight]; used with -nodes")
+    autocreate := flag.Bool("autocreate-nodes", false,
+        "with -nodes, add vertices that are only named in -edges instead of failing")
+    trace := flag.String("trace", "",
+        "log each clique candidate of this vertex and why it was accepted or rejected")
+    estimate := flag.Bool("estimate", false,
+        "print an upper bound on the number of k-clique candidates and exit")
+    ego := flag.String("ego", "",
+        "run CPM on the neighborhood of this vertex only, out to -radius hops")
+    radius := flag.Int("radius", 1, "number of hops around the -ego vertex")
+    compact := flag.Bool("compact", false,
+        "print only the communities, one line each, instead of the graphs")
+    jobs := flag.Int("jobs", 1,
+        "number of goroutines comparing cliques for the community graph and extracting its communities")
+    label_map := flag.String("label-map", "",
+        "rename vertices after parsing with this file of old<TAB>new lines")
+    stream_cliques := flag.Bool("stream-cliques", false,
+        "read an edge list from the file (or standard input) and print each k-clique as soon as it is complete")
+    color := flag.Bool("color", false,
+        "color each community's line in the text output when writing to a terminal")
+    report_filename := flag.String("report", "",
+        "write a human readable analysis of the result to this file")
+    record_options := flag.Bool("record-options", false,
+        "include the effective options in the output, so it records how to reproduce it")
+    print_options := flag.Bool("print-options", false,
+        "print the effective options as JSON and exit")
+    directed := flag.Bool("directed", false,
+        "keep edges listed by only one endpoint one-way instead of adding the reverse edge")
+    allow_self_loops := flag.Bool("allow-self-loops", false,
+        "keep vertices listed as their own neighbor instead of dropping the self-loop")
+    merge_dups := flag.Bool("merge-dups", false,
+        "merge a vertex defined on more than one line of a colon format file instead of failing")
+    only := flag.String("only", "",
+        "comma separated vertices; run CPM on the subgraph they induce")
+    flag.Parse()
+
+    // 0 stands for k-1 in Options, so an explicit 0 is caught here
+    min_overlap_given := false
+    flag.Visit(func(f *flag.Flag) {
+        if f.Name == "min-overlap" {
+            min_overlap_given = true
+        }
+    })
+    if min_overlap_given && *min_overlap < 1 {
+        fmt.Printf("-min-overlap: %d: must be at least 1\n", *min_overlap)
+        return
+    }
+    var mixed_sizes []int
+    if *mixed_k != "" {
+        for _, field := range strings.Split(*mixed_k, ",") {
+            size, err := strconv.Atoi(strings.TrimSpace(field))
+            if err != nil || size < 2 {
+                fmt.Printf("-mixed-k: %s: invalid clique size\n", field)
+                return
+            }
+            mixed_sizes = append(mixed_sizes, size)
+        }
+    }
+    opts := cpm.NewOptions(
+        cpm.WithK(*k),
+        cpm.WithMixedK(mixed_sizes...),
+        cpm.WithMinOverlap(*min_overlap),
+        cpm.WithWeightThreshold(*intensity),
+        cpm.WithLimits(limits),
+        cpm.WithAlgo(*algo),
+        cpm.WithPartitions(*partitions),
+        cpm.WithMergeThreshold(*merge_threshold),
+        cpm.WithDropContained(*drop_contained),
+        cpm.WithMergeIsolated(*merge_isolated),
+        cpm.WithRepeatable(*repeatable),
+        cpm.WithCheckpoint(*checkpoint, *checkpoint_every),
+        cpm.WithResume(*resume),
+        cpm.WithJobs(*jobs),
+    )
+    opts.ShowWeights = *show_weights
+    opts.ASCII = *ascii
+    opts.ShowVertexWeight = *show_vertex_weight
+    opts.ShowConductance = *show_conductance
+    opts.ShowDensity = *show_density
+    opts.TopCommunities = *top_communities
+    opts.Compact = *compact
+    opts.Color = *color && cpm.IsTerminal(os.Stdout)
+    opts.RecordOptions = *record_options
+    if *print_options {
+        data, _ := json.MarshalIndent(cpm.RecordOptions(opts), "", "  ")
+        fmt.Printf("%s\n", data)
+        return
+    }
+    if *highlight != "" {
+        opts.Highlight = strings.Split(*highlight, ",")
+    }
+    var popts cpm.ParseOptions
+    popts.MergeDuplicates = *merge_dups
+    popts.Directed = *directed
+    popts.AllowSelfLoops = *allow_self_loops
+    if *serve != "" {
+        err := cpm.Serve(*serve, opts, *informat, popts, *max_request_bytes)
+        fmt.Printf("%s\n", err.Error())
+        return
+    }
+
+    if (*nodes_filename == "") != (*edges_filename == "") {
+        fmt.Printf("-nodes and -edges must be given together\n")
+        return
+    }
+    if *stream_cliques {
+        input := os.Stdin
+        if len(flag.Args()) > 0 && flag.Arg(0) != "-" {
+            file, err := os.Open(flag.Arg(0))
+            if err != nil {
+                fmt.Printf("%s\n", err.Error())
+                return
+            }
+            defer file.Close()
+            input = file
+        }
+        err := cpm.StreamEdgeCliques(input, os.Stdout, *k)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+        }
+        return
+    }
+
+     if len(flag.Args()) == 0 && *nodes_filename == "" {
+        fmt.Printf("no graph definition file")
+        return
+    }
+
+    if *canonicalize {
+        for _, filename := range flag.Args() {
+            if err := cpm.CanonicalizeFile(filename); err != nil {
+                fmt.Printf("%s: %s\n", filename, err.Error())
+                return
+            }
+        }
+        return
+    }
+
+    // Several graph files are merged into one graph; "-" reads one
+    // of them from standard input.
+    var shards [][]*cpm.GraphNode
+    stdin_used := false
+    unweighted := 0
+    if *nodes_filename != "" {
+        parsed, err := cpm.ParseNodesEdgesFiles(*nodes_filename, *edges_filename, *autocreate,
+            popts)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+        if *verbose {
+            for _, warning := range parsed.Warnings {
+                fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+            }
+        }
+        shards = append(shards, parsed.Graph)
+        unweighted += parsed.Unweighted
+    }
+    for _, arg := range flag.Args() {
+        graph_def_filename, file_informat, err := cpm.SplitFormatSuffix(arg, *informat)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+        if graph_def_filename == "-" {
+            if stdin_used {
+                fmt.Printf("-: standard input can only be read once\n")
+                return
+            }
+            stdin_used = true
+        }
+        parsed, err := cpm.ParseGraphFile(graph_def_filename, file_informat, popts)
+        if err != nil {
+            if len(flag.Args()) > 1 {
+                fmt.Printf("%s: ", graph_def_filename)
+            }
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+        if *verbose {
+            for _, warning := range parsed.Warnings {
+                if len(flag.Args()) > 1 {
+                    warning = graph_def_filename + ": " + warning
+                }
+                fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+            }
+        }
+        shards = append(shards, parsed.Graph)
+        unweighted += parsed.Unweighted
+    }
+    if *require_weights && *intensity > 0 && unweighted > 0 {
+        fmt.Printf("-require-weights: %d edges have no explicit weight\n", unweighted)
+        return
+    }
+    graph = shards[0]
+    if len(shards) > 1 {
+        graph = cpm.MergeGraphs(shards...)
+    }
+
+    if *label_map != "" {
+        file, err := os.Open(*label_map)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+        mapping, err := cpm.ReadLabelMap(file)
+        file.Close()
+        if err == nil {
+            err = cpm.RelabelGraph(graph, mapping)
+        }
+        if err != nil {
+            fmt.Printf("%s: %s\n", *label_map, err.Error())
+            return
+        }
+    }
+
+    if *save_gob != "" {
+        err := cpm.SaveGob(*save_gob, graph)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+    }
+
+    if *transpose {
+        if cpm.IsUndirected(graph) {
+            fmt.Fprintf(os.Stderr, "-transpose: the graph is undirected, so it is unchanged\n")
+        }
+        graph = cpm.Transpose(graph)
+    }
+
+    if *only != "" {
+        nodes, err := cpm.SelectNodes(graph, strings.Split(*only, ","))
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+        graph = cpm.InducedSubgraph(nodes)
+    }
+
+    if *lcc {
+        component := cpm.LargestComponent(graph)
+        fmt.Fprintf(os.Stderr, "-lcc: %d of %d vertices excluded\n",
+            len(graph) - len(component), len(graph))
+        graph = component
+    }
+
+    if *ego != "" {
+        center := cpm.GetNode(graph, *ego)
+        if center == nil {
+            fmt.Printf("-ego: %s: doesn't exist\n", *ego)
+            return
+        }
+        if *radius < 0 {
+            fmt.Printf("-radius: %d: must not be negative\n", *radius)
+            return
+        }
+        graph = cpm.EgoSubgraph(graph, center, *radius)
+    }
+
+    if *prune_leaves {
+        if *k < 3 || *mixed_k != "" {
+            fmt.Printf("-prune-leaves: needs k >= 3 and no -mixed-k\n")
+            return
+        }
+        pruned, removed := cpm.PruneLeaves(graph)
+        fmt.Fprintf(os.Stderr, "-prune-leaves: %d of %d vertices pruned\n",
+            removed, len(graph))
+        graph = pruned
+    }
+
+    if *list_triangles {
+        for _, triangle := range cpm.Triangles(graph) {
+            fmt.Printf("%s %s %s\n", triangle[0], triangle[1], triangle[2])
+        }
+        return
+    }
+
+    if *sample_cliques > 0 {
+        for _, nodes := range cpm.SampleCliques(graph, *k, *sample_cliques, *seed) {
+            cpm.FprintCliques(os.Stdout, cpm.NewClique(nodes))
+        }
+        return
+    }
+
+    if *stats {
+        triangles, triples, transitivity := cpm.Transitivity(graph)
+        fmt.Printf("vertices:     %d\n", len(graph))
+        fmt.Printf("edges:        %d\n", cpm.EdgeCount(graph))
+        fmt.Printf("density:      %.4f\n", cpm.Density(graph))
+        fmt.Printf("triangles:    %d\n", triangles)
+        fmt.Printf("triples:      %d\n", triples)
+        fmt.Printf("transitivity: %.4f\n", transitivity)
+        return
+    }
+
+    if *weight_quantiles {
+        quantiles := cpm.WeightQuantiles(graph)
+        if quantiles == nil {
+            fmt.Printf("no edges\n")
+            return
+        }
+        names := []string{"min", "25%", "median", "75%", "max"}
+        for i, name := range names {
+            fmt.Printf("%-6s %.4g\n", name, quantiles[i])
+        }
+        return
+    }
+
+    // -compare-algos cross-checks that the candidate generator and
+    // Bron-Kerbosch agree on the input.
+    if *compare_algos {
+        same, difference := cpm.CompareCliques(cpm.FindKCliques(graph, *k), "candidates",
+            cpm.BronKerboschKCliques(graph, *k), "bk")
+        if same {
+            fmt.Printf("compare-algos: pass\n")
+        } else {
+            fmt.Printf("compare-algos: FAIL: %s\n", difference)
+        }
+        return
+    }
+
+    if *force_connected {
+        graph = cpm.ForceConnected(graph)
+    }
+
+    if *estimate {
+        fmt.Printf("clique candidates: at most %d\n", cpm.CandidateEstimate(graph, *k))
+        return
+    }
+    if *trace != "" {
+        node := cpm.GetNode(graph, *trace)
+        if node == nil {
+            fmt.Printf("-trace: %s: doesn't exist\n", *trace)
+            return
+        }
+        cpm.TraceCliqueSearch(os.Stderr, node, *k, opts.Accept)
+    }
+    if *stop_at_first {
+        fmt.Printf("%t\n", cpm.HasCommunity(graph, *k, opts.Accept))
+        return
+    }
+    if *validate_k_range != "" {
+        var lo, hi int
+        _, err := fmt.Sscanf(*validate_k_range, "%d-%d", &lo, &hi)
+        if err != nil {
+            fmt.Printf("-validate-k-range: %s: expected LO-HI\n", *validate_k_range)
+            return
+        }
+        best, scores, err := cpm.ValidateKRange(graph, opts, lo, hi, *criterion)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+        fmt.Printf("%-4s %-12s %s\n", "k", "communities", *criterion)
+        for _, score := range scores {
+            fmt.Printf("%-4d %-12d %.4f\n", score.K, score.Communities, score.Score)
+        }
+        fmt.Printf("best k: %d\n", best)
+        return
+    }
+    result, err := cpm.Run(graph, opts)
+    if *verbose && result.CliquesSkipped {
+        fmt.Fprintf(os.Stderr, "clique search: skipped (complete graph)\n")
+    } else if *verbose && result.Algo != "" && result.Algo != "gn" {
+        fmt.Fprintf(os.Stderr, "clique search: %s (density %.4f)\n", result.Algo,
+            cpm.Density(graph))
+    }
+    if *verbose {
+        fmt.Fprintf(os.Stderr, "slowest nodes:\n")
+        for _, timing := range cpm.SlowestNodes(result.NodeTimings, cpm.SLOWEST_NODES) {
+            fmt.Fprintf(os.Stderr, "  %s (degree %d): %v\n", timing.Node.Label(),
+                timing.Node.Degree(), timing.Duration)
+        }
+    }
+    if err != nil {
+        fmt.Printf("%s\n", err.Error())
+        return
+    }
+    for _, warning := range result.Warnings {
+        fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+    }
+ 
+    if *degenerate_check {
+        for _, problem := range cpm.VerifyCliques(result.Cliques) {
+            fmt.Printf("warning: %s\n", problem)
+        }
+    }
+
+    err = cpm.WriteResult(os.Stdout, *outformat, result)
+    if err != nil {
+        fmt.Printf("%s\n", err.Error())
+        return
+    }
+
+    if *report_filename != "" {
+        file, err := os.Create(*report_filename)
+        if err == nil {
+            cpm.WriteReport(file, result)
+            err = file.Close()
+        }
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+    }
+
+    if *explain_id != 0 {
+        fmt.Printf("\n")
+        err = cpm.ExplainCommunity(os.Stdout, result, *explain_id)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+    }
+
+    if *top_bridges > 0 {
+        fmt.Printf("\nBridge vertices:\n")
+        bridges := cpm.Bridges(result)
+        if len(bridges) > *top_bridges {
+            bridges = bridges[:*top_bridges]
+        }
+        for _, bridge := range bridges {
+            fmt.Printf("  %s: %d pairs, communities", bridge.Label, bridge.Pairs)
+            for _, id := range bridge.Communities {
+                fmt.Printf(" %d", id)
+            }
+            fmt.Printf("\n")
+        }
+    }
+
+    if *explain_uncovered {
+        fmt.Printf("\n")
+        cpm.ExplainUncovered(os.Stdout, result)
+    }
+
+    if *fingerprint {
+        fmt.Printf("\nfingerprint: %s\n", cpm.Fingerprint(result))
+    }
+
+    if *sqlite_filename != "" {
+        err = cpm.WriteSQLiteFile(*sqlite_filename, result)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+    }
+
+    if *index_map_filename != "" {
+        err = cpm.WriteIndexMapFile(*index_map_filename, result.Graph)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+    }
+
+    if *community_dot_dir != "" {
+        err = cpm.WriteCommunityDOTFiles(*community_dot_dir, result)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+    }
+
+    if *dump_dir != "" {
+        err = cpm.DumpIntermediate(*dump_dir, result)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+    }
+
+    if *cliques_by_size_dir != "" {
+        err = cpm.WriteCliquesBySize(*cliques_by_size_dir, result.Graph, *k)
+        if err != nil {
+            fmt.Printf("%s\n", err.Error())
+            return
+        }
+    }
+}
@@ -0,0 +1,142 @@
+package main
+
+import "encoding/json"
+import "flag"
+import "io"
+import "os"
+import "path/filepath"
+import "reflect"
+import "strings"
+import "testing"
+
+import "github.com/jonrobin3/cpm"
+
+// runMain runs main with the given arguments, feeding it stdin, and
+// returns what it wrote to standard output.
+
+func runMain(t *testing.T, stdin string, args ...string) string {
+    flag.CommandLine = flag.NewFlagSet("cpm", flag.ExitOnError)
+    os.Args = append([]string{"cpm"}, args...)
+    in_r, in_w, err := os.Pipe()
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    out_r, out_w, err := os.Pipe()
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    saved_stdin, saved_stdout := os.Stdin, os.Stdout
+    os.Stdin, os.Stdout = in_r, out_w
+    defer func() {
+        os.Stdin, os.Stdout = saved_stdin, saved_stdout
+        in_r.Close()
+    }()
+
+    go func() {
+        in_w.WriteString(stdin)
+        in_w.Close()
+    }()
+    output := make(chan string)
+    go func() {
+        data, _ := io.ReadAll(out_r)
+        output <- string(data)
+    }()
+    main()
+    out_w.Close()
+    return <-output
+}
+
+func TestStdinAndFile(t *testing.T) {
+    model, err := os.ReadFile("../../examples/model.txt")
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    triangle := filepath.Join(t.TempDir(), "triangle.txt")
+    os.WriteFile(triangle, []byte("x: y z\ny: x z\nz: x y\n"), 0644)
+
+    out := runMain(t, string(model), "-repeatable", "-", triangle)
+    _, communities, _ := strings.Cut(out, "Communities:\n------------\n")
+    want := "Community 1: v1 v2 v3\nCommunity 2: v10 v8 v9\n" +
+        "Community 3: v3 v4 v5 v6 v7 v8\nCommunity 4: x y z\n"
+    if communities != want {
+        t.Errorf("communities\n%s\nwant\n%s", communities, want)
+    }
+
+    if out := runMain(t, string(model), "-", "-"); out != "-: standard input can only be read once\n" {
+        t.Errorf("- -: got %q", out)
+    }
+}
+
+func TestRequireWeights(t *testing.T) {
+    edges := filepath.Join(t.TempDir(), "edges.csv")
+    os.WriteFile(edges, []byte("a,b,0.5\nb,c\na,c,2\n"), 0644)
+
+    out := runMain(t, "", "-w", "0.5", "-require-weights", "-informat", "csv", edges)
+    if want := "-require-weights: 1 edges have no explicit weight\n"; out != want {
+        t.Errorf("got %q, want %q", out, want)
+    }
+    out = runMain(t, "", "-w", "0.5", "-informat", "csv", edges)
+    if strings.HasPrefix(out, "-require-weights") {
+        t.Errorf("without -require-weights: got %q", out)
+    }
+}
+
+func TestColorNotTerminal(t *testing.T) {
+    out := runMain(t, "", "-color", "../../examples/model.txt")
+    if strings.Contains(out, "Community 1:") == false {
+        t.Fatalf("no communities in\n%s", out)
+    }
+    if strings.Contains(out, "\x1b[") {
+        t.Errorf("ANSI codes written to a pipe:\n%q", out)
+    }
+}
+
+func TestPrintOptions(t *testing.T) {
+    out := runMain(t, "", "-print-options", "-k", "4", "-w", "0.5", "-algo", "bk", "-repeatable")
+    var record cpm.OptionsRecord
+    if err := json.Unmarshal([]byte(out), &record); err != nil {
+        t.Fatalf("%q: %s", out, err.Error())
+    }
+    want := cpm.OptionsRecord{K: 4, WeightThreshold: 0.5, Algo: "bk", Repeatable: true}
+    if reflect.DeepEqual(record, want) == false {
+        t.Errorf("options %+v, want %+v", record, want)
+    }
+}
+
+func TestStopAtFirstCommunity(t *testing.T) {
+    // a lone triangle is a community, though nothing percolates
+    triangle := "x: y z\ny: x z\nz: x y\n"
+    for _, fixture := range []struct {
+        args []string
+        want string
+    }{
+        {[]string{"../../examples/model.txt"}, "true\n"},
+        {[]string{"-"}, "true\n"},
+        {[]string{"-k", "4", "-"}, "false\n"},
+    } {
+        args := append([]string{"-stop-at-first-community"}, fixture.args...)
+        if out := runMain(t, triangle, args...); out != fixture.want {
+            t.Errorf("%q: got %q, want %q", args, out, fixture.want)
+        }
+    }
+}
+
+func TestMinOverlapFlag(t *testing.T) {
+    for _, fixture := range []struct {
+        args []string
+        want string
+    }{
+        {[]string{"-min-overlap", "0"}, "-min-overlap: 0: must be at least 1\n"},
+        {[]string{"-min-overlap", "3"}, "min-overlap=3: must be between 1 and k-1 = 2\n"},
+        {[]string{"-k", "4", "-min-overlap", "4"}, "min-overlap=4: must be between 1 and k-1 = 3\n"},
+    } {
+        args := append(fixture.args, "../../examples/model.txt")
+        if out := runMain(t, "", args...); out != fixture.want {
+            t.Errorf("%q: got %q, want %q", args, out, fixture.want)
+        }
+    }
+    out := runMain(t, "", "-compact", "-min-overlap", "1", "../../examples/model.txt")
+    if strings.Contains(out, "v1 v10 v2 v3 v4 v5 v6 v7 v8 v9") == false {
+        t.Errorf("-min-overlap 1: got\n%s\nwant one community of every vertex", out)
+    }
+}
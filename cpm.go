@@ -1,13 +1,17 @@
 //
 // BUILD INSTRUCTIONS:
-//     go build cpm.go
+//     go build ./cmd/cpm
 //
 // RUN INSTRUCTIONS:
-//     ./cpm [-k=int] graphFileDef
+//     ./cpm [-k=int] [-dump-intermediate=dir] graphFileDef
 //
 // PARAMETERS:
 // `-k` is an optional argument that specifies the size of the
 // clique. If k is not specified, it defaults to k=3.
+//
+// `-dump-intermediate` is an optional directory that receives one
+// file per pipeline stage: the parsed graph, the k-cliques, the
+// community graph and the final communities.
 // 
 // `graphDefinitionFile` defines the graph to operate on. Vertices
 // (nodes) are declared on the left hand side (lhs) of the
@@ -76,25 +80,57 @@
 //
 
 
-package main
+package cpm
 
 import "fmt"
-import "flag"
 import "os"
 import "regexp"
 import "bufio"
 import "unicode"
+import "unicode/utf8"
 import "strings"
+import "strconv"
 import "errors"
+import "io"
+import "path/filepath"
+import "time"
+import "database/sql"
+import "encoding/csv"
+import "math"
+import "encoding/json"
+import "sort"
+import "archive/tar"
+import "compress/gzip"
+import "bytes"
+import "crypto/sha256"
+import "encoding/hex"
+import "encoding/gob"
+import "math/rand"
+import "net/http"
+import "sync"
 
-const MAX_LINE_LEN = 256
+const MAX_LINE_LEN = 256 // read buffer size; longer lines are read in pieces
+const MAX_ASCII_NODES = 20 // largest community graph drawn by -ascii
+const SLOWEST_NODES = 10 // number of slowest nodes reported by -v
+const AUTO_BK_DENSITY = 0.5 // graphs denser than this get -algo bk under "auto"
+const SERVE_READ_TIMEOUT = 30 * time.Second // for reading a -serve request
+const SERVE_MAX_DURATION = 60 * time.Second // default clique search bound per -serve request
+const SERVE_MAX_CANDIDATES = 10000000 // default -max-candidates per -serve request
 
 type GraphNode struct {
     label string  // any string, but in our model case (v1, v2, ..., v10)
     neighbors []*GraphNode // records edges from this node. 
+    neighbor_set map[*GraphNode]bool // the members of neighbors, for
+                                     // IsConnected; kept by AddWeightedNeighbor
+    weights []float64 // weights[i] is the weight of the edge to
+                      // neighbors[i]; 1.0 unless a weight was given
     associated_clique *Clique // required when building community
                               // graph; not required for starting
                               // graph
+    vertex_weight float64 // importance of the vertex; 1.0 unless
+                          // given as `v1[3.0]:` in the definition
+    virtual bool // added by a preprocessing step, not part of the
+                 // input graph; never reported in results
 }
 
 type CliqueCandidate struct {
@@ -105,6 +141,197 @@ type CliqueCandidate struct {
 type Clique struct {
     nodes []*GraphNode
     next *Clique
+    id string // cached by ID
+}
+
+// Options configures a CPM run. See Run.
+type Options struct {
+    K int                   // size of the cliques
+    Accept CliqueAcceptFunc // optional clique filter; nil accepts all
+    WeightThreshold float64 // the CPMw threshold behind Accept, if that is what it is
+    Limits Limits           // bounds on the clique search
+    MergeThreshold float64  // Jaccard threshold for merging communities; 0 disables
+    DropContained bool      // drop cliques contained in larger cliques
+    ShowWeights bool        // print edge weights in text output
+    ASCII bool              // draw the community graph as text boxes
+    Repeatable bool         // canonical ordering of everything; see Run
+    Algo string             // clique search: "auto" (default), "candidates" or "bk"; "gn" for Girvan-Newman
+    Partitions int          // number of communities for Algo "gn"
+    MixedK []int            // percolate cliques of all these sizes together; overrides K
+    MinOverlap int          // vertices two cliques must share to percolate; 0 for K-1
+    Highlight []string      // labels of vertices to highlight in DOT output
+    Checkpoint string       // file to save the clique search state to
+    CheckpointEvery int     // save it after every this many nodes
+    Resume string           // checkpoint file to resume the clique search from
+    ShowVertexWeight bool   // print each community's total vertex weight
+    ShowConductance bool    // print each community's conductance
+    ShowDensity bool        // print each community's internal edge density
+    TopCommunities int      // list only this many of the largest communities; 0 lists none
+    Compact bool            // print only the communities, no graphs
+    Color bool              // draw community lines in ANSI colors
+    RecordOptions bool      // include the OptionsRecord in the output
+    MergeIsolated bool      // fold uncovered vertices into their neighbors' community
+    Jobs int                // goroutines building and splitting the community graph; 0 or 1 is serial
+}
+
+// OptionsRecord is the part of an Options that determines the result,
+// in a form that can be written out, so that a result records how to
+// reproduce it. CustomFilter is set when Accept is a filter other than
+// the WeightThreshold one, which can't be written out.
+type OptionsRecord struct {
+    K int `json:"k"`
+    MixedK []int `json:"mixed_k,omitempty"`
+    MinOverlap int `json:"min_overlap,omitempty"`
+    WeightThreshold float64 `json:"weight_threshold"`
+    CustomFilter bool `json:"custom_filter,omitempty"`
+    Algo string `json:"algo"`
+    Partitions int `json:"partitions,omitempty"`
+    MergeThreshold float64 `json:"merge_threshold"`
+    DropContained bool `json:"drop_contained"`
+    MergeIsolated bool `json:"merge_isolated"`
+    Repeatable bool `json:"repeatable"`
+    MaxNodes int `json:"max_nodes,omitempty"`
+    MaxEdges int `json:"max_edges,omitempty"`
+    MaxCandidates int `json:"max_candidates,omitempty"`
+    MaxCliques int `json:"max_cliques,omitempty"`
+    MaxDuration string `json:"max_duration,omitempty"`
+}
+
+// FUNCTION: RecordOptions
+//
+// DESCRIPTION: Returns the OptionsRecord of opts.
+
+func RecordOptions(opts Options) OptionsRecord {
+    var record OptionsRecord
+    record.K = opts.K
+    record.MixedK = opts.MixedK
+    record.MinOverlap = opts.MinOverlap
+    record.WeightThreshold = opts.WeightThreshold
+    record.CustomFilter = opts.Accept != nil && opts.WeightThreshold <= 0
+    record.Algo = opts.Algo
+    if opts.Algo == "gn" {
+        record.Partitions = opts.Partitions
+    }
+    record.MergeThreshold = opts.MergeThreshold
+    record.DropContained = opts.DropContained
+    record.MergeIsolated = opts.MergeIsolated
+    record.Repeatable = opts.Repeatable
+    record.MaxNodes = opts.Limits.MaxNodes
+    record.MaxEdges = opts.Limits.MaxEdges
+    record.MaxCandidates = opts.Limits.MaxCandidates
+    record.MaxCliques = opts.Limits.MaxCliques
+    if opts.Limits.MaxDuration > 0 {
+        record.MaxDuration = opts.Limits.MaxDuration.String()
+    }
+    return record
+}
+
+// FUNCTION: OptionsComment
+//
+// DESCRIPTION: Returns the OptionsRecord of opts as one line of
+// compact JSON, for the comment headers of the text formats.
+
+func OptionsComment(opts Options) string {
+    data, _ := json.Marshal(RecordOptions(opts))
+    return string(data)
+}
+
+// Option sets one field of an Options. Library callers build Options
+// with NewOptions and the With... functions, e.g.
+//
+//   result, err := Run(g, NewOptions(WithK(4), WithWeightThreshold(0.5)))
+type Option func(opts *Options)
+
+// CPMResult holds the outcome of a CPM run: every stage of the
+// pipeline plus summary statistics. Community ids are 1-based,
+// matching the numbering used when communities are printed.
+type CPMResult struct {
+    K int
+    Options Options             // the options the result was computed with
+    Graph []*GraphNode          // the graph CPM ran on
+    Cliques *Clique             // the k-cliques
+    CommunityGraph []*GraphNode // one node per k-clique
+    Communities [][]*GraphNode  // original graph vertices of each community
+    Components []int            // CommunityComponents index of each community,
+                                // or MERGED_COMPONENT
+    Membership map[string][]int // vertex label -> ids of its communities
+    Stats Stats
+    NodeTimings []NodeTiming    // clique search time per examination node
+    Uncovered []*GraphNode      // vertices still uncovered after Options.MergeIsolated
+    Warnings []string           // non-fatal notes about the run
+    Algo string                 // the clique search used; see ChooseAlgo
+    CliquesSkipped bool         // a complete graph: Cliques and CommunityGraph
+                                // are left empty; see Run
+}
+
+// Stats summarizes a CPMResult.
+type Stats struct {
+    Nodes int `json:"nodes"`
+    Edges int `json:"edges"`
+    Cliques int `json:"cliques"`
+    Communities int `json:"communities"`
+}
+
+// CliqueSearch configures SearchKCliques. Only K is required.
+type CliqueSearch struct {
+    K int
+    Accept CliqueAcceptFunc // optional clique filter; nil accepts all
+    Limits Limits
+    Start int               // index in the graph of the first examination node
+    Cliques *Clique         // cliques found by the nodes before Start
+    CheckpointEvery int     // call OnCheckpoint after every this many nodes
+    OnCheckpoint func(next int, clique_list *Clique) error
+}
+
+// Checkpoint is the saved state of an interrupted clique search: the
+// cliques found by the first Next examination nodes of a graph with
+// Nodes vertices. It is stored as JSON.
+type Checkpoint struct {
+    K int           `json:"k"`
+    Nodes int       `json:"nodes"`
+    Next int        `json:"next"`
+    Cliques [][]string `json:"cliques"`
+}
+
+// NodeTiming records how long the clique search spent on one
+// examination node.
+type NodeTiming struct {
+    Node *GraphNode
+    Duration time.Duration
+}
+
+// Limits bounds the work done while finding cliques. A zero value
+// for any field means that resource is unlimited.
+type Limits struct {
+    MaxNodes int
+    MaxEdges int
+    MaxCliques int
+    MaxCandidates int // bound on CandidateEstimate, checked up front
+    MaxDuration time.Duration
+}
+
+// ErrLimitExceeded is wrapped by the error returned when one of the
+// Limits is hit.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// CliqueAcceptFunc decides whether the vertices of a complete
+// subgraph should be recorded as a clique.
+type CliqueAcceptFunc func(nodes []*GraphNode) bool
+
+// ParseResult is a parsed graph together with the non-fatal problems
+// found while parsing it, such as skipped comment lines or edges
+// listed by only one of their endpoints.
+type ParseResult struct {
+    Graph []*GraphNode
+    Warnings []string
+    Unweighted int // edges given without an explicit weight
+}
+
+// ParseOptions configures the graph definition file parsers.
+type ParseOptions struct {
+    MergeDuplicates bool // merge repeated definitions of a vertex instead of failing
+    Directed bool // keep edges listed by only one endpoint one-way (see Symmetrize)
+    AllowSelfLoops bool // keep vertices listed as their own neighbor (see DropSelfLoops)
 }
 
 type NeighborSpec struct {
@@ -128,6 +355,7 @@ func NewGraphNode (label string, assoc_clique *Clique) *GraphNode {
     new_node := new(GraphNode)
     new_node.label = label
     new_node.associated_clique = assoc_clique
+    new_node.vertex_weight = 1.0
     return new_node
 }
 
@@ -137,550 +365,6512 @@ func NewGraphNode (label string, assoc_clique *Clique) *GraphNode {
 // neighbor list because there is an edge connecting gn and n.
 
 func AddNeighbor (gn *GraphNode, n *GraphNode) {
+    AddWeightedNeighbor(gn, n, 1.0)
+}
+
+// FUNCTION: AddWeightedNeighbor
+//
+// DESCRIPTION: Same as AddNeighbor, but records weight as the weight
+// of the edge from gn to n. All neighbors are added here, so that
+// neighbor_set stays in step with neighbors.
+
+func AddWeightedNeighbor (gn *GraphNode, n *GraphNode, weight float64) {
     gn.neighbors = append(gn.neighbors, n)
+    gn.weights = append(gn.weights, weight)
+    if gn.neighbor_set == nil {
+        gn.neighbor_set = make(map[*GraphNode]bool)
+    }
+    gn.neighbor_set[n] = true
 }
 
-// FUNCTION: GetNode
+// FUNCTION: EdgeWeight
 //
-// DESCRIPTION: Returns the graph node in g whose label matches
-// label. Otherwise, returns nil.
+// DESCRIPTION: Returns the weight of the edge from a to b, or 0 if
+// there is no such edge.
 
-func  GetNode(g []*GraphNode, label string) *GraphNode {
-    for _, n := range g {
-        if n.label == label {
-            return n
+func EdgeWeight (a *GraphNode, b *GraphNode) float64 {
+    for i, n := range a.neighbors {
+        if n == b {
+            return a.weights[i]
         }
     }
-    return nil
+    return 0
 }
 
+// FUNCTION: SetEdgeWeight
+//
+// DESCRIPTION: Sets the weight of the edge from a to b, if there is
+// one.
+
+func SetEdgeWeight (a *GraphNode, b *GraphNode, weight float64) {
+    for i, n := range a.neighbors {
+        if n == b {
+            a.weights[i] = weight
+        }
+    }
+}
 
-// FUNCTION: PrintGraph
+// FUNCTION: AddEdge
 //
-// DESCRIPTION: Prints a graph -- vertices and edges.
+// DESCRIPTION: Records an undirected edge between a and b by adding
+// each node to the other's neighbor list. Edges that are already
+// recorded are not added a second time.
 
-func PrintGraph(g []*GraphNode) {
-    if g == nil {
-        fmt.Printf("empty graph\n")
+func AddEdge (a *GraphNode, b *GraphNode) {
+    if b.IsConnected(a) == false {
+        AddNeighbor(a, b)
     }
-    for _, e := range g {
-        fmt.Printf("%s:  ", e.label)
-		for _, n := range e.neighbors {
-			fmt.Printf("%s ", n.label)
-		}
-        fmt.Printf("\n")
+    if a.IsConnected(b) == false {
+        AddNeighbor(b, a)
     }
 }
 
-// FUNCTION: GetCliqueCandidates
+// FUNCTION: AddWeightedEdge
 //
-// PARAMETERS:
-// - k int
-// - node_list []*GraphNode
+// DESCRIPTION: Same as AddEdge, but the edge has the given weight in
+// both directions. If the edge is already recorded, its weight is
+// replaced.
+
+func AddWeightedEdge (a *GraphNode, b *GraphNode, weight float64) {
+    if b.IsConnected(a) == false {
+        AddWeightedNeighbor(a, b, weight)
+    } else {
+        SetEdgeWeight(a, b, weight)
+    }
+    if a.IsConnected(b) == false {
+        AddWeightedNeighbor(b, a, weight)
+    } else {
+        SetEdgeWeight(b, a, weight)
+    }
+}
+
+// GraphBuilder builds a graph in code, e.g.
 //
-// DESCRIPTION: A recursive function that generates all the node
-// permutations that could form a k-clique for a given
-// node. node_list is essentially the neighbor list for some
-// node. For example, lets say we want to generate a candidate list
-// for v5 with k=3. The original node_list would be {v3, v4, v6, v7}
-// (all of v5's neighbors). We remove the first node, v3, and then
-// recursive call GetCliqueCandates with node_list = {v4, v6,
-// v7}. Again, we remove the first node, v4, and recursively call
-// with node_list equal to {v6, v7}. This is our anchor case because
-// k=3 and we will add v5 later to this canidate list, thus giving
-// us a {v5, v6, v7} candidate clique. When the recursive call
-// begins to unwind, we add the removed node in each slot of the
-// candidate list. For example, on the first unwind, we start with a
-// removed node of v4 and clique_list of {v6, v7}. v4 is substitued
-// for each element and this yields a clique_list of {v6, v7}, {v4,
-// v7}, and {v6, v4}. And this continues recursively. For v3, we
-// would then get a clique_list of:
+//   g, err := NewGraphBuilder().Strict().
+//       Node("v1", "v2", "v3").Node("v2", "v3").Node("v3").Build()
 //
-//              {v6, v7}
-//              {v4, v7}
-//              {v6, v4}
-//              {v3, v7}
-//              {v6, v3}
-//              {v3, v7}  -- duplicate, not added
-//              {v4, v3}
-//              {v3, v4}  -- duplicate, not added
-//              {v6, v3}  -- duplicate, not added
+// Build checks and cleans up the graph the way the file parser
+// should: repeated neighbors are recorded once, and unless Directed is
+// set every edge is added in both directions, so the neighbor lists
+// above need only name each edge once.
+type GraphBuilder struct {
+    labels []string
+    neighbors map[string][]string
+    strict bool
+    directed bool
+}
+
+// FUNCTION: NewGraphBuilder
 //
-// When the function returns, the caller can then make the final candidate
-// list using the examination node (v5 in our example). This will yield
-// a candidate clique list of:
+// DESCRIPTION: Returns an empty, undirected, non-strict GraphBuilder.
+
+func NewGraphBuilder() *GraphBuilder {
+    builder := new(GraphBuilder)
+    builder.neighbors = make(map[string][]string)
+    return builder
+}
+
+// FUNCTION: Strict
 //
-//              {v5, v6, v7}
-//              {v5, v4, v7}
-//              {v5, v6, v4}
-//              {v5, v3, v7}
-//              {v5, v6, v3}
-//              {v5, v4, v3}
+// DESCRIPTION: Makes Build fail when a neighbor names a vertex that
+// was never declared with Node. Otherwise such a vertex is created.
+
+func (builder *GraphBuilder) Strict() *GraphBuilder {
+    builder.strict = true
+    return builder
+}
+
+// FUNCTION: Directed
 //
+// DESCRIPTION: Records every edge only from the vertex that lists it,
+// as the graph definition file format does, instead of in both
+// directions.
+
+func (builder *GraphBuilder) Directed() *GraphBuilder {
+    builder.directed = true
+    return builder
+}
+
+// FUNCTION: Node
 //
-func GetCliqueCandidates (k int, node_list []*GraphNode) *CliqueCandidate {
+// DESCRIPTION: Declares the vertex label with edges to neighbors.
+// Declaring a vertex again adds to its neighbors.
 
-    if k < 2 {
-        return nil
-    }
-    if len(node_list) < k - 1 {
-        return nil
+func (builder *GraphBuilder) Node(label string, neighbors ...string) *GraphBuilder {
+    if _, ok := builder.neighbors[label]; ok == false {
+        builder.labels = append(builder.labels, label)
     }
-    if len(node_list) == k - 1 {
-        new_candidate := new (CliqueCandidate)
-        new_candidate.nodes = node_list
-        new_candidate.next = nil
-        return new_candidate
+    builder.neighbors[label] = append(builder.neighbors[label], neighbors...)
+    return builder
+}
+
+// FUNCTION: Build
+//
+// DESCRIPTION: Returns the graph, with vertices in the order they were
+// first declared (followed, unless Strict, by undeclared neighbors in
+// the order they were named).
+
+func (builder *GraphBuilder) Build() ([]*GraphNode, error) {
+    var graph []*GraphNode
+    nodes := make(map[string]*GraphNode)
+    for _, label := range builder.labels {
+        node := NewGraphNode(label, nil)
+        nodes[label] = node
+        graph = append(graph, node)
     }
-    
-    node := node_list[0] // the removed node
-    clique_list := GetCliqueCandidates(k, node_list[1:])
-    var return_clique_list *CliqueCandidate = clique_list
-    
-    for item := clique_list; item != nil; item = item.next {
-        for i, _ := range item.nodes {
-            new_candidate := new (CliqueCandidate)
-            new_candidate.nodes = make([]*GraphNode, len(item.nodes), len(item.nodes))
-            for k, v := range item.nodes {
-                new_candidate.nodes[k] = v
+
+    for _, label := range builder.labels {
+        node := nodes[label]
+        for _, neighbor_label := range builder.neighbors[label] {
+            neighbor, ok := nodes[neighbor_label]
+            if ok == false {
+                if builder.strict {
+                    errstr := fmt.Sprintf("%s: doesn't exist", neighbor_label)
+                    return graph, errors.New(errstr)
+                }
+                neighbor = NewGraphNode(neighbor_label, nil)
+                nodes[neighbor_label] = neighbor
+                graph = append(graph, neighbor)
             }
-            // new_candidate.nodes = item.nodes // copies array
-            new_candidate.nodes[i] = node
-            
-            // only add this candidate list if doesn't already exist
-            if new_candidate.IsDuplicate(return_clique_list) == false {
-                new_candidate.next = return_clique_list
-                return_clique_list = new_candidate
+            if builder.directed {
+                if neighbor.IsConnected(node) == false {
+                    AddNeighbor(node, neighbor)
+                }
+            } else {
+                AddEdge(node, neighbor)
             }
         }
     }
-    return return_clique_list
+    return graph, nil
 }
 
-// FUNCTION: MakeCliqueList
+// FUNCTION: GetNode
 //
-// PARAMETERS:
+// DESCRIPTION: Returns the graph node in g whose label matches
+// label. Otherwise, returns nil. Each call scans g; to look up many
+// labels, build a NodeIndex once instead.
+
+func  GetNode(g []*GraphNode, label string) *GraphNode {
+    for _, n := range g {
+        if n.label == label {
+            return n
+        }
+    }
+    return nil
+}
+
+// FUNCTION: NodeLabels
 //
-// - candidate_list *CliqueCandidate
-// - examination_node *GraphNode
+// DESCRIPTION: Returns the labels of nodes, in the same order.
+
+func NodeLabels(nodes []*GraphNode) []string {
+    labels := []string{}
+    for _, n := range nodes {
+        labels = append(labels, n.label)
+    }
+    return labels
+}
+
+// FUNCTION: Label
 //
-// DESCRIPTION: Determines if nodes on the candidate list are
-// completely connected. If the nodes are completely connected, then
-// it creates a clique, which includes all candidates and the
-// examination node and places them on the clique list to be returned.
+// DESCRIPTION: Returns the label of the node.
+
+func (node *GraphNode) Label() string {
+    return node.label
+}
+
+// FUNCTION: Degree
 //
-// For example, the following candidates would be generated for node
-// v5 in the Model Graph for a k = 3 clique, and this is what is
-// essentially returned from GetCliqueCandidates:
+// DESCRIPTION: Returns the number of neighbors the node lists.
+
+func (node *GraphNode) Degree() int {
+    return len(node.neighbors)
+}
+
+// NodeIndex maps labels to the nodes of a graph, for constant time
+// lookups. It is a snapshot: nodes added to the graph or relabeled
+// after IndexNodes built it are not reflected.
+type NodeIndex map[string]*GraphNode
+
+// FUNCTION: IndexNodes
 //
-//     - v6 v7  
-//     - v4 v7  
-//     - v6 v4  
-//     - v3 v4  
-//     - v6 v3  
-//     - v3 v7  
+// DESCRIPTION: Builds the NodeIndex of g. As with GetNode, the first
+// of several nodes with the same label is the one found.
+
+func IndexNodes(g []*GraphNode) NodeIndex {
+    index := make(NodeIndex, len(g))
+    for _, n := range g {
+        if _, ok := index[n.label]; ok == false {
+            index[n.label] = n
+        }
+    }
+    return index
+}
+
+// FUNCTION: Node
 //
-// These are just candidates to form a clique (k=3) with
-// v5. MakeCliqueList determines whether the above nodes do form a
-// clique with v5, and if they do then MakeCliqueList places a
-// Clique node on the return list. Here's what the determination should be
-// for the above candidates:
+// DESCRIPTION: Same as GetNode, on the graph index was built from.
+
+func (index NodeIndex) Node(label string) *GraphNode {
+    return index[label]
+}
+
+
+// FUNCTION: FprintGraph
 //
-//     - v6 v7  - yes, forms k=3 clique with v5
-//     - v4 v7  - yes  "
-//     - v6 v4  - yes  "
-//     - v3 v4  - yes  "
-//     - v6 v3  - no, does not form k=3 clique with v5 
-//     - v3 v7  - no, "
+// DESCRIPTION: Writes a graph -- vertices and edges -- to w.
+
+func FprintGraph(w io.Writer, g []*GraphNode) {
+    FprintWeightedGraph(w, g, false)
+}
+
+// FUNCTION: FprintWeightedGraph
 //
-// So, the return clique list should look like the following in the
-// case of examination node v5 and the above candidate list:
+// DESCRIPTION: Same as FprintGraph, but if show_weights is set and g
+// has weighted edges, each neighbor is followed by the weight of the
+// edge to it, e.g. `v1:  v2(0.8) v3(0.3)`. A graph without weights
+// prints as it does with FprintGraph.
+
+func FprintWeightedGraph(w io.Writer, g []*GraphNode, show_weights bool) {
+    show_weights = show_weights && HasWeights(g)
+    if g == nil {
+        fmt.Fprintf(w, "empty graph\n")
+    }
+    for _, e := range g {
+        fmt.Fprintf(w, "%s:  ", e.label)
+		for i, n := range e.neighbors {
+			if show_weights {
+				fmt.Fprintf(w, "%s(%g) ", n.label, e.weights[i])
+			} else {
+				fmt.Fprintf(w, "%s ", n.label)
+			}
+		}
+        fmt.Fprintf(w, "\n")
+    }
+}
+
+// FUNCTION: FprintASCIIGraph
 //
-//     +---------------------+     +--+--+--+
-//     |nodes []*GraphNodes--+---->|v5|v6|v7|
-//     |next *Clique         |     +--+--+--+
-//     |           |         |               
-//     +-----------+---------+               
-//                 |                         
-//                 v                         
-//     +---------------------+     +--+--+--+
-//     |nodes []*GraphNodes--+---->|v5|v4|v7|
-//     |next *Clique         |     +--+--+--+
-//     |           |         |               
-//     +-----------+---------+               
-//                 |                         
-//                 v                         
-//     +---------------------+     +--+--+--+
-//     |nodes []*GraphNodes--+---->|v5|v6|v4|
-//     |next *Clique         |     +--+--+--+
-//     |           |         |               
-//     +-----------+---------+               
-//                 |                         
-//                 v                         
-//     +---------------------+     +--+--+--+
-//     |nodes []*GraphNodes--+---->|v5|v4|v3|
-//     |next *Clique         |     +--+--+--+
-//     |           |         |               
-//     +-----------+---------+               
-//                 |                         
-//                 v                         
-//              +----+                      
-//              |nil |                      
-//              +----+                      
+// DESCRIPTION: Draws a small graph on w as text boxes, in the spirit
+// of the hand drawn Model Graph at the top of this file. Each vertex
+// is a box, all boxes are the same width, and the edges of a vertex
+// fan out to the right of its box:
 //
+//   +----------+
+//   | v4,v5,v3 |--+-- v5,v7,v4
+//   +----------+  +-- v6,v5,v4
 //
+// Graphs with more than MAX_ASCII_NODES vertices are not drawn; a
+// note is written instead.
 
-func MakeCliqueList(candidate_list *CliqueCandidate,
-                    examination_node *GraphNode) *Clique {
-
-    var clique_list *Clique = nil
+func FprintASCIIGraph(w io.Writer, g []*GraphNode) {
+    if len(g) > MAX_ASCII_NODES {
+        fmt.Fprintf(w, "%d nodes; too large to draw (max %d)\n",
+            len(g), MAX_ASCII_NODES)
+        return
+    }
+    width := 0
+    for _, node := range g {
+        if utf8.RuneCountInString(node.label) > width {
+            width = utf8.RuneCountInString(node.label)
+        }
+    }
+    border := "+" + strings.Repeat("-", width + 2) + "+"
+    blank := strings.Repeat(" ", width + 4)
 
-    for item := candidate_list; item != nil; item = item.next {
-        candidate_list_is_clique := true // assumed, not yet determined
-        item_nodes_len := len(item.nodes)
-        for i := 0; i < item_nodes_len && candidate_list_is_clique; i++ {
-            candidate_node := item.nodes[i]
-            for j := i + 1; j < item_nodes_len; j++ {
-                // if the candidate node is not connected to all other
-                // nodes then this candidate does not form clique
-                if candidate_node.IsConnected(item.nodes[j]) == false {
-                    candidate_list_is_clique = false
-                    break
-                }
+    for _, node := range g {
+        lines := []string{
+            border,
+            "| " + node.label + strings.Repeat(" ", width - utf8.RuneCountInString(node.label)) + " |",
+            border,
+        }
+        for i, n := range node.neighbors {
+            line := 1 + i
+            if line >= len(lines) {
+                lines = append(lines, blank)
+            }
+            if i == 0 {
+                lines[line] += "--+-- " + n.label
+            } else {
+                lines[line] += "  +-- " + n.label
             }
         }
-        if (candidate_list_is_clique == true) {
-            new_clique := new (Clique)
-            new_clique.nodes = make ([]*GraphNode,
-                item_nodes_len + 1,
-                item_nodes_len + 1)
-            copy (new_clique.nodes, item.nodes)
-            new_clique.nodes[item_nodes_len] = examination_node
-            new_clique.next = clique_list
-            clique_list = new_clique
+        for _, line := range lines {
+            fmt.Fprintf(w, "%s\n", strings.TrimRight(line, " "))
         }
     }
-    return clique_list
 }
 
-// FUNCTION: IsConnected
+// FUNCTION: HasWeights
 //
-// DESCRIPTION: Determines if the candidate node (cn) is connected to
-// some node (sn)
+// DESCRIPTION: Determines whether any edge of g has a weight other
+// than the default of 1.0.
 
-func (cn *GraphNode) IsConnected (sn *GraphNode) bool {
-    is_connected := false
-    for _,item := range sn.neighbors {
-        if item == cn {
-            is_connected = true
-            break
+func HasWeights(g []*GraphNode) bool {
+    for _, node := range g {
+        for _, weight := range node.weights {
+            if weight != 1.0 {
+                return true
+            }
         }
     }
-    return is_connected
+    return false
 }
 
-// FUNCTION: IsDuplicate
-// 
-// DESCRIPTION: After examining each node, we will have many
-// different duplicate clique candidates (i.e., candidates that all
-// have the same vertices). We need to create a candidate list that
-// has no duplicates and IsDuplicate determines that.
+// FUNCTION: InducedSubgraph
+//
+// DESCRIPTION: Returns the subgraph induced by nodes: a copy of
+// every node in nodes, keeping only the edges whose other endpoint
+// is also in nodes. The original graph is left untouched.
 
-func (cc *CliqueCandidate) IsDuplicate (clist *CliqueCandidate) bool {
-    return_val := false
-    
-    for item := clist; item != nil; item = item.next {
-        match_count := len (cc.nodes)
-        for _, ccnode := range cc.nodes {
-            for _, list_node := range item.nodes {
-                if (list_node == ccnode) {
-                    match_count--
-                    if match_count == 0 {
-                        return true // duplicate list found
-                    }
-                    break
-                }
+func InducedSubgraph(nodes []*GraphNode) []*GraphNode {
+    var subgraph []*GraphNode
+    copies := make(map[*GraphNode]*GraphNode)
+
+    for _, node := range nodes {
+        new_node := NewGraphNode(node.label, nil)
+        new_node.vertex_weight = node.vertex_weight
+        copies[node] = new_node
+        subgraph = append(subgraph, new_node)
+    }
+    for _, node := range nodes {
+        for i, n := range node.neighbors {
+            if nn, ok := copies[n]; ok {
+                AddWeightedNeighbor(copies[node], nn, node.weights[i])
             }
         }
     }
-    
-    return return_val
+    return subgraph
 }
 
-// FUNCTION: NotRecorded
+// FUNCTION: Transpose
 //
-// DESCRIPTION: Determines whether nor not the clique is already on
-// the clique_list. When we merge the candidate lists for each node,
-// we will invariably find duplicates, but we only want one unique
-// clique recorded -- not multiples.
+// DESCRIPTION: Returns a copy of g with every edge reversed: where a
+// lists b as a neighbor, the copy of b lists the copy of a, with the
+// same weight. Neighbor lists in the graph file give the edges out of
+// each vertex, so this turns out-edges into in-edges, e.g. to check
+// what can reach a vertex. An undirected graph, in which every edge is
+// listed by both endpoints (see IsUndirected), is its own transpose up
+// to neighbor order. The original graph is left untouched.
 
-func (clique *Clique) NotRecorded (clique_list *Clique) bool {
-    
-    for item := clique_list; item != nil; item = item.next {
-        match_count := len(item.nodes)
-        if match_count != len(clique.nodes) {
-            continue
+func Transpose(g []*GraphNode) []*GraphNode {
+    var transposed []*GraphNode
+    copies := make(map[*GraphNode]*GraphNode)
+
+    for _, node := range g {
+        new_node := NewGraphNode(node.label, nil)
+        new_node.vertex_weight = node.vertex_weight
+        new_node.virtual = node.virtual
+        copies[node] = new_node
+        transposed = append(transposed, new_node)
+    }
+    for _, node := range g {
+        for i, n := range node.neighbors {
+            if nn, ok := copies[n]; ok {
+                AddWeightedNeighbor(nn, copies[node], node.weights[i])
+            }
         }
-        for _, node := range item.nodes {
-            for _, exam_node := range clique.nodes {
-                if exam_node == node {
-                    match_count--
-                    if match_count == 0 {
-                        return false
-                    }
-                }
+    }
+    return transposed
+}
+
+// FUNCTION: IsUndirected
+//
+// DESCRIPTION: Reports whether every edge of g is listed by both of its
+// endpoints.
+
+func IsUndirected(g []*GraphNode) bool {
+    for _, node := range g {
+        for _, n := range node.neighbors {
+            if node.IsConnected(n) == false {
+                return false
             }
         }
     }
     return true
 }
 
-// FUNCTION: MergeCliques
-//
-// DESCRIPTION: Merges src_clique_list to dest_clique_list, and returns the
-// merged result.
+// FUNCTION: Symmetrize
 //
-func MergeCliques (dest_clique_list *Clique,
-    src_clique_list *Clique) (*Clique) {
+// DESCRIPTION: Makes g undirected: wherever a lists b but b doesn't
+// list a, b is given a as a neighbor, with the same edge weight.
+// Returns the number of edges added. An edge listed twice by a is
+// still only added to b once.
 
-        if dest_clique_list == nil {
-            return nil
+func Symmetrize(g []*GraphNode) int {
+    added := 0
+    for _, node := range g {
+        for i, n := range node.neighbors {
+            if node.IsConnected(n) == false {
+                AddWeightedNeighbor(n, node, node.weights[i])
+                added++
+            }
         }
+    }
+    return added
+}
 
-        var last_item *Clique
-        for last_item = dest_clique_list;
-            last_item.next != nil;
-            last_item = last_item.next {
-            }
+// FUNCTION: FilterNeighbors
+//
+// DESCRIPTION: Rebuilds the neighbor list of node, in order, with only
+// the neighbors for which keep returns true; keep sees the list built
+// so far in node. Returns the number of neighbors removed.
 
-        for clique := src_clique_list; clique != nil; clique = clique.next {
-            if clique.NotRecorded(dest_clique_list) == true {
-                new_clique := new(Clique)
-                new_clique.nodes = clique.nodes
-                new_clique.next = nil
-                last_item.next = new_clique
-                last_item = new_clique
-            }
+func FilterNeighbors(node *GraphNode, keep func(n *GraphNode) bool) int {
+    neighbors, weights := node.neighbors, node.weights
+    node.neighbors, node.weights, node.neighbor_set = nil, nil, nil
+    for i, n := range neighbors {
+        if keep(n) {
+            AddWeightedNeighbor(node, n, weights[i])
         }
-        return dest_clique_list
+    }
+    return len(neighbors) - len(node.neighbors)
 }
 
-// FUNCTION: CreateLabel
+// FUNCTION: DropSelfLoops
 //
-// DESCRIPTION: Generates a label for a node in the community
-// graph. It does this by concatening the labels of each vertex from
-// the origial graph that is in a clique to a single label name.
+// DESCRIPTION: Removes every vertex of g from its own neighbor list,
+// since a vertex that looks connected to itself confuses the clique
+// search. Returns the number of vertices that listed themselves.
 
-func CreateLabel (nodes []*GraphNode) string {
-    var new_label string
-    for i,item := range nodes {
-        if i == 0 {
-            new_label = item.label
-        } else {
-            new_label += "," + item.label
+func DropSelfLoops(g []*GraphNode) int {
+    dropped := 0
+    for _, node := range g {
+        if node.IsConnected(node) == false {
+            continue
         }
+        FilterNeighbors(node, func(n *GraphNode) bool { return n != node })
+        dropped++
     }
-    return new_label
+    return dropped
 }
 
-// FUNCTION: Kminu1CommonNodes
+// FUNCTION: DedupNeighbors
 //
-// DESCRIPTION: Determines if two nodes on the newly created
-// community graph share k-1 vertices from the original graph. If
-// so, then there should be an edge from gn and node in the
-// community graph.
+// DESCRIPTION: Removes the repeats of any neighbor listed more than
+// once by the same vertex of g, e.g. the second v2 of `v1: v2 v2 v3`,
+// so that each edge is recorded once and degrees are right. The
+// weight of the first listing is kept. Returns the number of repeats
+// removed.
 
-func Kminus1CommonNodes (gn *GraphNode, node *GraphNode, k int) bool {
-    common_node_count := 0
-    return_value := false
+func DedupNeighbors(g []*GraphNode) int {
+    removed := 0
+    for _, node := range g {
+        if len(node.neighbor_set) == len(node.neighbors) {
+            continue
+        }
+        removed += FilterNeighbors(node, func(n *GraphNode) bool {
+            return n.IsConnected(node) == false
+        })
+    }
+    return removed
+}
 
-    for _, exam_node := range gn.associated_clique.nodes {
-        for _, common_node := range node.associated_clique.nodes {
-            if exam_node == common_node {
-                common_node_count++
-                if common_node_count == k - 1 {
-                    return true
-                }
-            }
+// FUNCTION: NormalizeParsed
+//
+// DESCRIPTION: Tidies a parsed graph: repeated neighbors are removed
+// with DedupNeighbors, then, as popts says, self-loops are dropped
+// unless popts.AllowSelfLoops is set and the graph is made undirected
+// with Symmetrize unless popts.Directed is set. What was changed is
+// noted in the result's warnings.
+
+func NormalizeParsed(result *ParseResult, popts ParseOptions) {
+    if removed := DedupNeighbors(result.Graph); removed > 0 {
+        result.Warnings = append(result.Warnings,
+            fmt.Sprintf("removed %d repeated neighbors", removed))
+    }
+    if popts.AllowSelfLoops == false {
+        if dropped := DropSelfLoops(result.Graph); dropped > 0 {
+            result.Warnings = append(result.Warnings,
+                fmt.Sprintf("dropped the self-loops of %d vertices", dropped))
+        }
+    }
+    if popts.Directed == false {
+        if added := Symmetrize(result.Graph); added > 0 {
+            result.Warnings = append(result.Warnings,
+                fmt.Sprintf("added the reverse of %d edges listed by only one endpoint", added))
         }
     }
-    return return_value
 }
 
-// FUNCTION: AddNeighbors
+// FUNCTION: ReadLabelMap
 //
-// DESCRIPTION: Determines whether there is an edge between two
-// nodes in the generated community graph. If there is, that edge is
-// recorded as one of gn's neighbors.
+// DESCRIPTION: Reads a relabeling from r, one `old<TAB>new` line per
+// vertex. Blank lines are skipped. A line without a tab, an empty
+// label, or an old label mapped twice is an error.
 
-func AddNeighbors (graph []*GraphNode, gn *GraphNode, k int) {
-    for _, node := range graph {
-        if gn != node && Kminus1CommonNodes(gn, node, k) {
-            AddNeighbor(gn, node)
+func ReadLabelMap(r io.Reader) (map[string]string, error) {
+    mapping := make(map[string]string)
+    scanner := bufio.NewScanner(r)
+    line_count := 0
+    for scanner.Scan() {
+        line_count++
+        line := strings.TrimRight(scanner.Text(), "\r")
+        if strings.TrimSpace(line) == "" {
+            continue
+        }
+        fields := strings.Split(line, "\t")
+        if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+            errstr := fmt.Sprintf("line %d: expected old<TAB>new", line_count)
+            return nil, errors.New(errstr)
         }
+        if _, ok := mapping[fields[0]]; ok {
+            errstr := fmt.Sprintf("line %d: %s: mapped more than once", line_count, fields[0])
+            return nil, errors.New(errstr)
+        }
+        mapping[fields[0]] = fields[1]
     }
+    return mapping, scanner.Err()
 }
 
-// FUNCTION: CreateCommunityGraph
+// FUNCTION: RelabelGraph
 //
-// DESCRIPTION: Transforms every clique created from the original
-// graph into a node in the community graph. CreateCommunityGraph
-// also determines if there is an edge between vertices and adds the
-// appropriate neighbor nodes. For the nodes in the community graph
-// to be connected, they must have k-1 vertices in
-// common. CreateCommunityGraph returns a valid community graph for
-// k.
+// DESCRIPTION: Renames the vertices of g in place according to mapping
+// (old label -> new label); vertices not in mapping keep their labels.
+// If two vertices would end up with the same label, g is left
+// untouched and an error names them.
 
-func CreateCommunityGraph (clique_list *Clique, k int) []*GraphNode {
-    var community_graph []*GraphNode
-    if clique_list == nil {
-        return nil
+func RelabelGraph(g []*GraphNode, mapping map[string]string) error {
+    owner := make(map[string]*GraphNode)
+    labels := make([]string, len(g))
+    for i, node := range g {
+        label := node.label
+        if new_label, ok := mapping[label]; ok {
+            label = new_label
+        }
+        if other, ok := owner[label]; ok {
+            errstr := fmt.Sprintf("%s and %s would both be labeled %s",
+                other.label, node.label, label)
+            return errors.New(errstr)
+        }
+        owner[label] = node
+        labels[i] = label
     }
-    for item := clique_list; item != nil; item = item.next {
-        label := CreateLabel (item.nodes)
-        new_node := NewGraphNode(label, item)
-        community_graph = append(community_graph, new_node)
+    for i, node := range g {
+        node.label = labels[i]
     }
+    return nil
+}
 
-    for _, node := range community_graph {
-        AddNeighbors(community_graph, node, k)
+// FUNCTION: SelectNodes
+//
+// DESCRIPTION: Returns the nodes of g named by labels, in the order
+// given. An error is returned if any label is not a node of g.
+
+func SelectNodes(g []*GraphNode, labels []string) ([]*GraphNode, error) {
+    var nodes []*GraphNode
+    index := IndexNodes(g)
+    for _, label := range labels {
+        node := index.Node(strings.TrimSpace(label))
+        if node == nil {
+            errstr := fmt.Sprintf("%s: doesn't exist", label)
+            return nil, errors.New(errstr)
+        }
+        nodes = append(nodes, node)
     }
-    
-    return community_graph
+    return nodes, nil
 }
 
-// FUNCTION: ParseGraphDefFile
+// FUNCTION: ConnectedComponents
 //
-// DESCRIPTION: Given the filename of a graph definition file, this routine
-// parses the file and returns the graph if no syntax or semantic errors are
-// detected. If no errors are detected, then error returns as nil. Otherwise,
-// error will contain specific description of the problem. 
-
-func ParseGraphDefFile(filename string) (g []*GraphNode, error error) {
+// DESCRIPTION: Returns the connected components of g, each in breadth
+// first order from its first node. An edge listed by only one of its
+// endpoints still connects them.
 
-    var graph []*GraphNode
-    
-    file, err := os.Open(filename)
-    if err != nil {
-        return graph, err
+func ConnectedComponents(g []*GraphNode) [][]*GraphNode {
+    var components [][]*GraphNode
+    reverse := make(map[*GraphNode][]*GraphNode)
+    for _, node := range g {
+        for _, n := range node.neighbors {
+            reverse[n] = append(reverse[n], node)
+        }
     }
-    
-    node_def_re:= regexp.MustCompile(`\s*(\w+):\s*(.+)`)
-    node_no_neighbors_re := regexp.MustCompile(`\s*(\w+):\s*`)
-    var neighbor_spec_list []*NeighborSpec
-    line_count := 1
-    
-    lineReader := bufio.NewReaderSize(file, MAX_LINE_LEN)
-    for line, isPrefix, e := lineReader.ReadLine();
-    e == nil;
-    line, isPrefix, e = lineReader.ReadLine() {
-        if isPrefix == false {
-            slices := node_def_re.FindStringSubmatchIndex(string(line))
-            if slices != nil {
-                start := slices[2]
-                end := slices[3]
-                add_node_label := line[start:end]
-                new_node := NewGraphNode(string(add_node_label), nil)
-                graph = append(graph, new_node)
-                if graph == nil {
-                    errstr := fmt.Sprintf("'%s': duplicate node; unable to add to graph\n",
-                               new_node.label)
-                    return graph, errors.New(errstr)
-                }
-                start = slices[4]
-                end = slices[5]
-                neighbors_str := string(line[start:end])
-                // The following code determines if there are just spaces in the
-                // neighbor definition string. For example, a node definition of
-                // 'v1: ' is fine, but we need to account for the space because
-                // the regular expression node_def_re has matched the line but
-                // there are no neighbors.
-                neighbors_defined := false
-                for _, c := range neighbors_str {
-                    if unicode.IsSpace(c) == false {
-                        neighbors_defined = true
-                        break
+
+    visited := make(map[*GraphNode]bool)
+    for _, start := range g {
+        if visited[start] {
+            continue
+        }
+        var component []*GraphNode
+        queue := []*GraphNode{start}
+        visited[start] = true
+        for len(queue) > 0 {
+            node := queue[0]
+            queue = queue[1:]
+            component = append(component, node)
+            for _, list := range [][]*GraphNode{node.neighbors, reverse[node]} {
+                for _, n := range list {
+                    if visited[n] == false {
+                        visited[n] = true
+                        queue = append(queue, n)
                     }
                 }
-                if neighbors_defined == true {                    
-                    neighbor_spec := new(NeighborSpec)
-                    neighbor_spec.node = new_node
-                    neighbor_spec.neighbor_str = neighbors_str
-                    neighbor_spec_list = append(neighbor_spec_list, neighbor_spec)
-                }
-               
-            } else {
-                slices = node_no_neighbors_re.FindStringSubmatchIndex(string(line))
-                if slices == nil {
-                    errstr := fmt.Sprintf("line %d: syntax error\n", line_count)
-                    return graph, errors.New(errstr)                    
-                }
-                start := slices[2]
-                end := slices[3]
-                add_node_label := line[start:end]
-                new_node := NewGraphNode(string(add_node_label), nil)
-                graph = append(graph, new_node)
             }
-            line_count++
         }
+        components = append(components, component)
     }
+    return components
+}
 
-   for _, ns := range neighbor_spec_list {
-        neighbors := strings.Split(ns.neighbor_str, " ")
-        for _, neighbor_label := range neighbors {
-            nn := GetNode(graph, neighbor_label)
-            if nn == nil {
-                errstr := fmt.Sprintf( "%s: doesn't exist", neighbor_label)
-                return graph, errors.New(errstr)
-            } else {
-                AddNeighbor(ns.node, nn)
+// FUNCTION: EgoSubgraph
+//
+// DESCRIPTION: Returns the subgraph of g induced by center and every
+// vertex within radius hops of it, found by a breadth first search in
+// which an edge listed by only one endpoint still counts, as in
+// ConnectedComponents. The vertices are in the order of g. Running CPM
+// on it finds the communities local to center. The original graph is
+// left untouched.
+
+func EgoSubgraph(g []*GraphNode, center *GraphNode, radius int) []*GraphNode {
+    reverse := make(map[*GraphNode][]*GraphNode)
+    for _, node := range g {
+        for _, n := range node.neighbors {
+            reverse[n] = append(reverse[n], node)
+        }
+    }
+
+    distance := map[*GraphNode]int{center: 0}
+    queue := []*GraphNode{center}
+    for len(queue) > 0 {
+        node := queue[0]
+        queue = queue[1:]
+        if distance[node] == radius {
+            continue
+        }
+        for _, list := range [][]*GraphNode{node.neighbors, reverse[node]} {
+            for _, n := range list {
+                if _, seen := distance[n]; seen == false {
+                    distance[n] = distance[node] + 1
+                    queue = append(queue, n)
+                }
             }
         }
     }
-    
-    return graph, nil
+    var nodes []*GraphNode
+    for _, node := range g {
+        if _, ok := distance[node]; ok {
+            nodes = append(nodes, node)
+        }
+    }
+    return InducedSubgraph(nodes)
 }
 
-func main() {
-    var graph []*GraphNode
-    
-    // Process command line args
-    k := flag.Int("k", 3, "the size of k-clique")
-    flag.Parse()
-    
-     if len(flag.Args()) != 1 {
-        fmt.Printf("no graph definition file")
-        return
+// FUNCTION: LargestComponent
+//
+// DESCRIPTION: Returns the subgraph induced by the largest connected
+// component of g (the first one found if several tie), with its
+// vertices in the order of g. The original graph is left untouched.
+
+func LargestComponent(g []*GraphNode) []*GraphNode {
+    var largest []*GraphNode
+    for _, component := range ConnectedComponents(g) {
+        if len(component) > len(largest) {
+            largest = component
+        }
+    }
+    member := make(map[*GraphNode]bool)
+    for _, node := range largest {
+        member[node] = true
+    }
+    var nodes []*GraphNode
+    for _, node := range g {
+        if member[node] {
+            nodes = append(nodes, node)
+        }
     }
+    return InducedSubgraph(nodes)
+}
 
-    graph_def_filename := flag.Args()[0]
-    graph, err := ParseGraphDefFile(graph_def_filename)
-    if err != nil {
-        fmt.Printf("%s\n", err.Error())
-		return
+// FUNCTION: PruneLeaves
+//
+// DESCRIPTION: Returns the subgraph of g left after repeatedly
+// removing every vertex of degree 0 or 1, and the number of vertices
+// removed. Removing a leaf can turn its neighbor into a leaf, which is
+// removed in turn, so whole trees hanging off the graph disappear.
+// Such vertices are in no k-clique for k >= 3, so the communities are
+// unchanged for those k. Degrees are undirected. The original graph is
+// left untouched.
+
+func PruneLeaves(g []*GraphNode) ([]*GraphNode, int) {
+    adjacent := make(map[*GraphNode]map[*GraphNode]bool)
+    for _, node := range g {
+        adjacent[node] = make(map[*GraphNode]bool)
+    }
+    for _, node := range g {
+        for _, n := range node.neighbors {
+            if _, ok := adjacent[n]; ok && n != node {
+                adjacent[node][n] = true
+                adjacent[n][node] = true
+            }
+        }
     }
 
-    fmt.Printf("k= %d\n", *k)
-    fmt.Printf("The original graph\n")
-    fmt.Printf("------------------\n")
-    PrintGraph(graph)
-    fmt.Printf("\n")
+    removed := make(map[*GraphNode]bool)
+    var queue []*GraphNode
+    for _, node := range g {
+        if len(adjacent[node]) <= 1 {
+            removed[node] = true
+            queue = append(queue, node)
+        }
+    }
+    for len(queue) > 0 {
+        node := queue[0]
+        queue = queue[1:]
+        for n := range adjacent[node] {
+            delete(adjacent[n], node)
+            if removed[n] == false && len(adjacent[n]) <= 1 {
+                removed[n] = true
+                queue = append(queue, n)
+            }
+        }
+    }
+
+    var nodes []*GraphNode
+    for _, node := range g {
+        if removed[node] == false {
+            nodes = append(nodes, node)
+        }
+    }
+    return InducedSubgraph(nodes), len(removed)
+}
+
+// FUNCTION: GirvanNewman
+//
+// DESCRIPTION: Splits g into target non-overlapping communities with
+// the Girvan-Newman method, as a classic baseline to compare CPM's
+// overlapping communities against. The edge with the highest
+// betweenness (the number of shortest paths between pairs of vertices
+// that run through it, computed with Brandes' algorithm) is removed,
+// the betweenness recomputed, and so on until the graph falls apart
+// into target connected components, or runs out of edges. Ties go to
+// the edge first in graph order. Edges are taken to be undirected and
+// virtual vertices are left out. The communities are the components,
+// each with its vertices in graph order.
+
+func GirvanNewman(g []*GraphNode, target int) [][]*GraphNode {
+    var nodes []*GraphNode
+    position := make(map[*GraphNode]int)
+    for _, node := range g {
+        if node.virtual == false {
+            position[node] = len(nodes)
+            nodes = append(nodes, node)
+        }
+    }
+    n := len(nodes)
+    adjacent := make([]map[int]bool, n)
+    for i := range adjacent {
+        adjacent[i] = make(map[int]bool)
+    }
+    for i, node := range nodes {
+        for _, neighbor := range node.neighbors {
+            j, ok := position[neighbor]
+            if ok && j != i {
+                adjacent[i][j] = true
+                adjacent[j][i] = true
+            }
+        }
+    }
+    sorted_neighbors := func(v int) []int {
+        var list []int
+        for w := range adjacent[v] {
+            list = append(list, w)
+        }
+        sort.Ints(list)
+        return list
+    }
+
+    components := func() [][]*GraphNode {
+        var result [][]*GraphNode
+        component_of := make([]int, n)
+        for i := range component_of {
+            component_of[i] = -1
+        }
+        for start := 0; start < n; start++ {
+            if component_of[start] >= 0 {
+                continue
+            }
+            id := len(result)
+            result = append(result, nil)
+            component_of[start] = id
+            queue := []int{start}
+            for len(queue) > 0 {
+                v := queue[0]
+                queue = queue[1:]
+                for w := range adjacent[v] {
+                    if component_of[w] < 0 {
+                        component_of[w] = id
+                        queue = append(queue, w)
+                    }
+                }
+            }
+        }
+        for i, node := range nodes {
+            result[component_of[i]] = append(result[component_of[i]], node)
+        }
+        return result
+    }
+
+    for {
+        communities := components()
+        if len(communities) >= target {
+            return communities
+        }
+
+        betweenness := make(map[[2]int]float64)
+        for s := 0; s < n; s++ {
+            sigma := make([]float64, n)
+            distance := make([]int, n)
+            predecessors := make([][]int, n)
+            for i := range distance {
+                distance[i] = -1
+            }
+            sigma[s] = 1
+            distance[s] = 0
+            var order []int
+            queue := []int{s}
+            for len(queue) > 0 {
+                v := queue[0]
+                queue = queue[1:]
+                order = append(order, v)
+                for _, w := range sorted_neighbors(v) {
+                    if distance[w] < 0 {
+                        distance[w] = distance[v] + 1
+                        queue = append(queue, w)
+                    }
+                    if distance[w] == distance[v] + 1 {
+                        sigma[w] += sigma[v]
+                        predecessors[w] = append(predecessors[w], v)
+                    }
+                }
+            }
+            delta := make([]float64, n)
+            for i := len(order) - 1; i >= 0; i-- {
+                w := order[i]
+                for _, v := range predecessors[w] {
+                    c := sigma[v] / sigma[w] * (1 + delta[w])
+                    edge := [2]int{v, w}
+                    if w < v {
+                        edge = [2]int{w, v}
+                    }
+                    betweenness[edge] += c
+                    delta[v] += c
+                }
+            }
+        }
+        if len(betweenness) == 0 {
+            return communities
+        }
+
+        best := [2]int{-1, -1}
+        for v := 0; v < n; v++ {
+            for _, w := range sorted_neighbors(v) {
+                edge := [2]int{v, w}
+                if w < v {
+                    continue
+                }
+                if best[0] < 0 || betweenness[edge] > betweenness[best] {
+                    best = edge
+                }
+            }
+        }
+        delete(adjacent[best[0]], best[1])
+        delete(adjacent[best[1]], best[0])
+    }
+}
+
+// FUNCTION: MergeGraphs
+//
+// DESCRIPTION: Merges several graphs into a new one. Vertices with
+// the same label become a single vertex, whose neighbors are the union
+// of theirs; each edge is recorded once, with the weight it was first
+// seen with. The vertex weight is also taken from the first graph the
+// vertex appears in. Vertices keep the order in which they are first
+// seen. The input graphs are left untouched.
+
+func MergeGraphs(graphs ...[]*GraphNode) []*GraphNode {
+    var merged []*GraphNode
+    nodes := make(map[string]*GraphNode)
+    get_node := func(source *GraphNode) *GraphNode {
+        node, ok := nodes[source.label]
+        if ok == false {
+            node = NewGraphNode(source.label, nil)
+            node.vertex_weight = source.vertex_weight
+            node.virtual = source.virtual
+            nodes[source.label] = node
+            merged = append(merged, node)
+        }
+        return node
+    }
+
+    seen := make(map[[2]*GraphNode]bool)
+    for _, g := range graphs {
+        for _, source := range g {
+            node := get_node(source)
+            for i, n := range source.neighbors {
+                neighbor := get_node(n)
+                if seen[[2]*GraphNode{node, neighbor}] == false {
+                    seen[[2]*GraphNode{node, neighbor}] = true
+                    AddWeightedNeighbor(node, neighbor, source.weights[i])
+                }
+            }
+        }
+    }
+    return merged
+}
+
+// FUNCTION: ForceConnected
+//
+// DESCRIPTION: Makes g connected by adding a virtual hub vertex,
+// labelled "<hub>", with an edge to the first vertex of every
+// connected component. The hub is marked virtual: Run never records a
+// clique containing it, so it can't percolate components together or
+// appear in any community. A graph that is already connected is
+// returned unchanged.
+
+func ForceConnected(g []*GraphNode) []*GraphNode {
+    components := ConnectedComponents(g)
+    if len(components) < 2 {
+        return g
+    }
+    hub := NewGraphNode("<hub>", nil)
+    hub.virtual = true
+    for _, component := range components {
+        AddEdge(hub, component[0])
+    }
+    return append(g, hub)
+}
+
+// FUNCTION: ExcludeVirtual
+//
+// DESCRIPTION: Wraps accept so that cliques containing a virtual
+// vertex are rejected. A nil accept otherwise accepts every clique.
+
+func ExcludeVirtual(accept CliqueAcceptFunc) CliqueAcceptFunc {
+    return func(nodes []*GraphNode) bool {
+        for _, node := range nodes {
+            if node.virtual {
+                return false
+            }
+        }
+        return accept == nil || accept(nodes)
+    }
+}
+
+// FUNCTION: GetCliqueCandidates
+//
+// PARAMETERS:
+// - k int
+// - node_list []*GraphNode
+//
+// DESCRIPTION: A recursive function that generates all the node
+// permutations that could form a k-clique for a given
+// node. node_list is essentially the neighbor list for some
+// node. For example, lets say we want to generate a candidate list
+// for v5 with k=3. The original node_list would be {v3, v4, v6, v7}
+// (all of v5's neighbors). We remove the first node, v3, and then
+// recursive call GetCliqueCandates with node_list = {v4, v6,
+// v7}. Again, we remove the first node, v4, and recursively call
+// with node_list equal to {v6, v7}. This is our anchor case because
+// k=3 and we will add v5 later to this canidate list, thus giving
+// us a {v5, v6, v7} candidate clique. When the recursive call
+// begins to unwind, we add the removed node in each slot of the
+// candidate list. For example, on the first unwind, we start with a
+// removed node of v4 and clique_list of {v6, v7}. v4 is substitued
+// for each element and this yields a clique_list of {v6, v7}, {v4,
+// v7}, and {v6, v4}. And this continues recursively. For v3, we
+// would then get a clique_list of:
+//
+//              {v6, v7}
+//              {v4, v7}
+//              {v6, v4}
+//              {v3, v7}
+//              {v6, v3}
+//              {v3, v7}  -- duplicate, not added
+//              {v4, v3}
+//              {v3, v4}  -- duplicate, not added
+//              {v6, v3}  -- duplicate, not added
+//
+// When the function returns, the caller can then make the final candidate
+// list using the examination node (v5 in our example). This will yield
+// a candidate clique list of:
+//
+//              {v5, v6, v7}
+//              {v5, v4, v7}
+//              {v5, v6, v4}
+//              {v5, v3, v7}
+//              {v5, v6, v3}
+//              {v5, v4, v3}
+//
+//
+func GetCliqueCandidates (k int, node_list []*GraphNode) *CliqueCandidate {
+
+    if k < 2 {
+        return nil
+    }
+    if len(node_list) < k - 1 {
+        return nil
+    }
+    if len(node_list) == k - 1 {
+        new_candidate := new (CliqueCandidate)
+        new_candidate.nodes = node_list
+        new_candidate.next = nil
+        return new_candidate
+    }
+    
+    node := node_list[0] // the removed node
+    clique_list := GetCliqueCandidates(k, node_list[1:])
+    var return_clique_list *CliqueCandidate = clique_list
+    
+    for item := clique_list; item != nil; item = item.next {
+        for i, _ := range item.nodes {
+            new_candidate := new (CliqueCandidate)
+            new_candidate.nodes = make([]*GraphNode, len(item.nodes), len(item.nodes))
+            for k, v := range item.nodes {
+                new_candidate.nodes[k] = v
+            }
+            // new_candidate.nodes = item.nodes // copies array
+            new_candidate.nodes[i] = node
+            
+            // only add this candidate list if doesn't already exist
+            if new_candidate.IsDuplicate(return_clique_list) == false {
+                new_candidate.next = return_clique_list
+                return_clique_list = new_candidate
+            }
+        }
+    }
+    return return_clique_list
+}
+
+// FUNCTION: MakeCliqueList
+//
+// PARAMETERS:
+//
+// - candidate_list *CliqueCandidate
+// - examination_node *GraphNode
+//
+// DESCRIPTION: Determines if nodes on the candidate list are
+// completely connected. If the nodes are completely connected, then
+// it creates a clique, which includes all candidates and the
+// examination node and places them on the clique list to be returned.
+//
+// For example, the following candidates would be generated for node
+// v5 in the Model Graph for a k = 3 clique, and this is what is
+// essentially returned from GetCliqueCandidates:
+//
+//     - v6 v7  
+//     - v4 v7  
+//     - v6 v4  
+//     - v3 v4  
+//     - v6 v3  
+//     - v3 v7  
+//
+// These are just candidates to form a clique (k=3) with
+// v5. MakeCliqueList determines whether the above nodes do form a
+// clique with v5, and if they do then MakeCliqueList places a
+// Clique node on the return list. Here's what the determination should be
+// for the above candidates:
+//
+//     - v6 v7  - yes, forms k=3 clique with v5
+//     - v4 v7  - yes  "
+//     - v6 v4  - yes  "
+//     - v3 v4  - yes  "
+//     - v6 v3  - no, does not form k=3 clique with v5 
+//     - v3 v7  - no, "
+//
+// So, the return clique list should look like the following in the
+// case of examination node v5 and the above candidate list:
+//
+//     +---------------------+     +--+--+--+
+//     |nodes []*GraphNodes--+---->|v5|v6|v7|
+//     |next *Clique         |     +--+--+--+
+//     |           |         |               
+//     +-----------+---------+               
+//                 |                         
+//                 v                         
+//     +---------------------+     +--+--+--+
+//     |nodes []*GraphNodes--+---->|v5|v4|v7|
+//     |next *Clique         |     +--+--+--+
+//     |           |         |               
+//     +-----------+---------+               
+//                 |                         
+//                 v                         
+//     +---------------------+     +--+--+--+
+//     |nodes []*GraphNodes--+---->|v5|v6|v4|
+//     |next *Clique         |     +--+--+--+
+//     |           |         |               
+//     +-----------+---------+               
+//                 |                         
+//                 v                         
+//     +---------------------+     +--+--+--+
+//     |nodes []*GraphNodes--+---->|v5|v4|v3|
+//     |next *Clique         |     +--+--+--+
+//     |           |         |               
+//     +-----------+---------+               
+//                 |                         
+//                 v                         
+//              +----+                      
+//              |nil |                      
+//              +----+                      
+//
+//
+
+func MakeCliqueList(candidate_list *CliqueCandidate,
+                    examination_node *GraphNode) *Clique {
 
     var clique_list *Clique = nil
-    for _, node := range graph {
-        candidate_list := GetCliqueCandidates(*k, node.neighbors)
-        if candidate_list != nil {
-            temp_clique_list := MakeCliqueList(candidate_list, node)
-            if clique_list == nil {
-                clique_list = temp_clique_list
-            } else {
-                clique_list = MergeCliques(clique_list, temp_clique_list)
+
+    for item := candidate_list; item != nil; item = item.next {
+        candidate_list_is_clique := true // assumed, not yet determined
+        item_nodes_len := len(item.nodes)
+        for i := 0; i < item_nodes_len && candidate_list_is_clique; i++ {
+            candidate_node := item.nodes[i]
+            for j := i + 1; j < item_nodes_len; j++ {
+                // if the candidate node is not connected to all other
+                // nodes then this candidate does not form clique
+                if candidate_node.IsConnected(item.nodes[j]) == false {
+                    candidate_list_is_clique = false
+                    break
+                }
+            }
+        }
+        if (candidate_list_is_clique == true) {
+            new_clique := new (Clique)
+            new_clique.nodes = make ([]*GraphNode,
+                item_nodes_len + 1,
+                item_nodes_len + 1)
+            copy (new_clique.nodes, item.nodes)
+            new_clique.nodes[item_nodes_len] = examination_node
+            new_clique.next = clique_list
+            clique_list = new_clique
+        }
+    }
+    return clique_list
+}
+
+// FUNCTION: IsConnected
+//
+// DESCRIPTION: Determines if the candidate node (cn) is connected to
+// some node (sn), i.e. if sn lists cn as a neighbor. This is a set
+// lookup, not a scan of sn.neighbors.
+
+func (cn *GraphNode) IsConnected (sn *GraphNode) bool {
+    return sn.neighbor_set[cn]
+}
+
+// FUNCTION: IsDuplicate
+// 
+// DESCRIPTION: After examining each node, we will have many
+// different duplicate clique candidates (i.e., candidates that all
+// have the same vertices). We need to create a candidate list that
+// has no duplicates and IsDuplicate determines that.
+
+func (cc *CliqueCandidate) IsDuplicate (clist *CliqueCandidate) bool {
+    return_val := false
+    
+    for item := clist; item != nil; item = item.next {
+        match_count := len (cc.nodes)
+        for _, ccnode := range cc.nodes {
+            for _, list_node := range item.nodes {
+                if (list_node == ccnode) {
+                    match_count--
+                    if match_count == 0 {
+                        return true // duplicate list found
+                    }
+                    break
+                }
+            }
+        }
+    }
+    
+    return return_val
+}
+
+// FUNCTION: NotRecorded
+//
+// DESCRIPTION: Determines whether nor not the clique is already on
+// the clique_list. When we merge the candidate lists for each node,
+// we will invariably find duplicates, but we only want one unique
+// clique recorded -- not multiples.
+
+func (clique *Clique) NotRecorded (clique_list *Clique) bool {
+    
+    for item := clique_list; item != nil; item = item.next {
+        match_count := len(item.nodes)
+        if match_count != len(clique.nodes) {
+            continue
+        }
+        for _, node := range item.nodes {
+            for _, exam_node := range clique.nodes {
+                if exam_node == node {
+                    match_count--
+                    if match_count == 0 {
+                        return false
+                    }
+                }
+            }
+        }
+    }
+    return true
+}
+
+// FUNCTION: MergeCliques
+//
+// DESCRIPTION: Merges src_clique_list to dest_clique_list, and returns the
+// merged result.
+//
+func MergeCliques (dest_clique_list *Clique,
+    src_clique_list *Clique) (*Clique) {
+
+        if dest_clique_list == nil {
+            return nil
+        }
+
+        var last_item *Clique
+        for last_item = dest_clique_list;
+            last_item.next != nil;
+            last_item = last_item.next {
+            }
+
+        for clique := src_clique_list; clique != nil; clique = clique.next {
+            if clique.NotRecorded(dest_clique_list) == true {
+                new_clique := new(Clique)
+                new_clique.nodes = clique.nodes
+                new_clique.next = nil
+                last_item.next = new_clique
+                last_item = new_clique
+            }
+        }
+        return dest_clique_list
+}
+
+// FUNCTION: Triangles
+//
+// DESCRIPTION: Lists every triangle (3-clique) of g with the classic
+// node iterator algorithm, which is much faster than the general
+// candidate generator for k=3. Vertices are ranked by degree (ties
+// broken by position in g) and each vertex only looks for triangles
+// among its higher ranked neighbors, so every triangle is found
+// exactly once, from its lowest ranked vertex. The labels of each
+// triangle are returned in rank order.
+
+func Triangles(g []*GraphNode) [][3]string {
+    var triangles [][3]string
+    rank := make(map[*GraphNode]int)
+    order := make([]*GraphNode, len(g))
+    copy(order, g)
+    sort.SliceStable(order, func(i, j int) bool {
+        return len(order[i].neighbors) < len(order[j].neighbors)
+    })
+    for i, node := range order {
+        rank[node] = i
+    }
+
+    for _, u := range order {
+        var higher []*GraphNode
+        for _, v := range u.neighbors {
+            if rank[v] > rank[u] {
+                higher = append(higher, v)
+            }
+        }
+        sort.Slice(higher, func(i, j int) bool {
+            return rank[higher[i]] < rank[higher[j]]
+        })
+        for i, v := range higher {
+            for _, w := range higher[i + 1:] {
+                if w.IsConnected(v) {
+                    triangles = append(triangles, [3]string{u.label, v.label, w.label})
+                }
+            }
+        }
+    }
+    return triangles
+}
+
+// FUNCTION: Transitivity
+//
+// DESCRIPTION: Returns the number of triangles of g, the number of
+// connected triples (paths of two edges, counted once per center
+// vertex) and the global clustering coefficient: three times the
+// triangles over the connected triples. The coefficient is 0 when
+// there are no connected triples.
+
+func Transitivity(g []*GraphNode) (int, int, float64) {
+    triangles := len(Triangles(g))
+    degree := make(map[*GraphNode]int)
+    for _, edge := range Edges(g) {
+        degree[edge[0]]++
+        degree[edge[1]]++
+    }
+    triples := 0
+    for _, d := range degree {
+        triples += d * (d - 1) / 2
+    }
+    if triples == 0 {
+        return triangles, triples, 0
+    }
+    return triangles, triples, 3 * float64(triangles) / float64(triples)
+}
+
+// FUNCTION: IsComplete
+//
+// DESCRIPTION: Determines whether g is a complete graph: every vertex
+// is adjacent to every other vertex, in both directions.
+
+func IsComplete(g []*GraphNode) bool {
+    member := make(map[*GraphNode]bool)
+    for _, node := range g {
+        member[node] = true
+    }
+    for _, node := range g {
+        adjacent := make(map[*GraphNode]bool)
+        for _, n := range node.neighbors {
+            if n != node && member[n] {
+                adjacent[n] = true
+            }
+        }
+        if len(adjacent) != len(g) - 1 {
+            return false
+        }
+    }
+    return true
+}
+
+// FUNCTION: Density
+//
+// DESCRIPTION: Returns the fraction of all possible edges between the
+// vertices of g that are present.
+
+func Density(g []*GraphNode) float64 {
+    n := len(g)
+    if n < 2 {
+        return 0
+    }
+    return 2 * float64(EdgeCount(g)) / float64(n * (n - 1))
+}
+
+// FUNCTION: MaximalCliques
+//
+// DESCRIPTION: Lists every maximal clique of g with the Bron-Kerbosch
+// algorithm, using Tomita pivoting: R is the clique being grown, P the
+// vertices that can still extend it and X the vertices already
+// tried. Only the vertices of P that are not neighbors of the pivot
+// need to be branched on. Each clique's vertices are in the order of
+// g.
+
+func MaximalCliques(g []*GraphNode) [][]*GraphNode {
+    var cliques [][]*GraphNode
+    position := make(map[*GraphNode]int)
+    adjacent := make(map[*GraphNode]map[*GraphNode]bool)
+    for i, node := range g {
+        position[node] = i
+        adjacent[node] = make(map[*GraphNode]bool)
+        for _, n := range node.neighbors {
+            if n != node {
+                adjacent[node][n] = true
+            }
+        }
+    }
+
+    var expand func(r []*GraphNode, p []*GraphNode, x []*GraphNode)
+    expand = func(r []*GraphNode, p []*GraphNode, x []*GraphNode) {
+        if len(p) == 0 && len(x) == 0 {
+            clique := append([]*GraphNode{}, r...)
+            sort.Slice(clique, func(i, j int) bool {
+                return position[clique[i]] < position[clique[j]]
+            })
+            cliques = append(cliques, clique)
+            return
+        }
+        var pivot *GraphNode
+        best := -1
+        for _, list := range [][]*GraphNode{p, x} {
+            for _, u := range list {
+                count := 0
+                for _, v := range p {
+                    if adjacent[u][v] {
+                        count++
+                    }
+                }
+                if count > best {
+                    best = count
+                    pivot = u
+                }
+            }
+        }
+        var branches []*GraphNode
+        for _, v := range p {
+            if adjacent[pivot][v] == false {
+                branches = append(branches, v)
+            }
+        }
+        for _, v := range branches {
+            var new_p, new_x []*GraphNode
+            for _, n := range p {
+                if adjacent[v][n] {
+                    new_p = append(new_p, n)
+                }
+            }
+            for _, n := range x {
+                if adjacent[v][n] {
+                    new_x = append(new_x, n)
+                }
+            }
+            expand(append(r, v), new_p, new_x)
+            for i, n := range p {
+                if n == v {
+                    p = append(p[:i:i], p[i + 1:]...)
+                    break
+                }
+            }
+            x = append(x, v)
+        }
+    }
+    expand(nil, append([]*GraphNode{}, g...), nil)
+    return cliques
+}
+
+// FUNCTION: BronKerboschKCliques
+//
+// DESCRIPTION: Finds every k-clique of g from its maximal cliques:
+// each k-subset of a maximal clique with at least k vertices is a
+// k-clique, and every k-clique is contained in some maximal clique.
+// A k-clique inside several maximal cliques is only recorded once.
+// This is much faster than the candidate generator on dense graphs,
+// where neighbor lists are long but maximal cliques are few.
+
+func BronKerboschKCliques(g []*GraphNode, k int) *Clique {
+    var head *Clique = nil
+    var tail *Clique = nil
+    EachKClique(MaximalCliques(g), k, func(nodes []*GraphNode) {
+        clique := new(Clique)
+        clique.nodes = nodes
+        if tail == nil {
+            head = clique
+        } else {
+            tail.next = clique
+        }
+        tail = clique
+    })
+    return head
+}
+
+// FUNCTION: EachKClique
+//
+// DESCRIPTION: Calls visit once for every k-clique contained in the
+// given maximal cliques, as they are generated, so the k-cliques
+// don't need to be held in a list. Only a key per k-clique is kept
+// to skip the ones shared by several maximal cliques.
+
+func EachKClique(maximal_cliques [][]*GraphNode, k int, visit func(nodes []*GraphNode)) {
+    if k < 2 {
+        return
+    }
+    seen := make(map[string]bool)
+    for _, maximal := range maximal_cliques {
+        if len(maximal) < k {
+            continue
+        }
+        subset := make([]int, k)
+        for i := range subset {
+            subset[i] = i
+        }
+        for {
+            nodes := make([]*GraphNode, k)
+            for i, j := range subset {
+                nodes[i] = maximal[j]
+            }
+            key := fmt.Sprintf("%p", nodes[0])
+            for _, node := range nodes[1:] {
+                key += fmt.Sprintf(",%p", node)
+            }
+            if seen[key] == false {
+                seen[key] = true
+                visit(nodes)
+            }
+            // advance to the next k-subset in lexicographic order
+            i := k - 1
+            for i >= 0 && subset[i] == len(maximal) - k + i {
+                i--
+            }
+            if i < 0 {
+                break
+            }
+            subset[i]++
+            for j := i + 1; j < k; j++ {
+                subset[j] = subset[j - 1] + 1
+            }
+        }
+    }
+}
+
+// FUNCTION: StreamKCliques
+//
+// DESCRIPTION: Calls visit once for every k-clique of g, without
+// keeping any of them: vertices are numbered in graph order and each
+// clique is grown only with vertices numbered higher than its last
+// one, so it is generated exactly once, in increasing order. Memory
+// use is bounded by k and the vertex degrees however many cliques
+// there are. The nodes slice passed to visit is reused, so visit must
+// copy it to keep it. Returning false from visit stops the stream.
+
+func StreamKCliques(g []*GraphNode, k int, visit func(nodes []*GraphNode) bool) {
+    if k < 2 {
+        return
+    }
+    position := make(map[*GraphNode]int)
+    for i, node := range g {
+        position[node] = i
+    }
+    higher := make([][]int, len(g))
+    for i, node := range g {
+        for _, n := range node.neighbors {
+            // n comes from node's list; the edge must be listed by n too
+            if j, ok := position[n]; ok && j > i && node.IsConnected(n) {
+                higher[i] = append(higher[i], j)
+            }
+        }
+        sort.Ints(higher[i])
+    }
+
+    nodes := make([]*GraphNode, 0, k)
+    var extend func(candidates []int) bool
+    extend = func(candidates []int) bool {
+        if len(nodes) == k {
+            return visit(nodes)
+        }
+        for _, v := range candidates {
+            // the vertices after v that are adjacent to every vertex so far
+            var next []int
+            for _, w := range candidates {
+                if w > v && g[w].IsConnected(g[v]) && g[v].IsConnected(g[w]) {
+                    next = append(next, w)
+                }
+            }
+            if len(next) < k - len(nodes) - 1 {
+                continue
+            }
+            nodes = append(nodes, g[v])
+            ok := extend(next)
+            nodes = nodes[:len(nodes) - 1]
+            if ok == false {
+                return false
+            }
+        }
+        return true
+    }
+    for i := range g {
+        if len(higher[i]) < k - 1 {
+            continue
+        }
+        nodes = append(nodes[:0], g[i])
+        if extend(higher[i]) == false {
+            return
+        }
+    }
+}
+
+// CliqueStream grows a graph one edge at a time and reports the
+// k-cliques each edge completes, for input that arrives as an
+// unbounded stream of edges, e.g.
+//
+//   stream := NewCliqueStream(3)
+//   stream.AddEdge("v1", "v2") // no cliques yet
+//   stream.AddEdge("v2", "v3")
+//   stream.AddEdge("v1", "v3") // returns the clique v1 v3 v2
+//
+// Edges are undirected. Every k-clique is reported exactly once, by
+// the edge that completes it.
+type CliqueStream struct {
+    k int
+    nodes map[string]*GraphNode
+    adjacent map[*GraphNode]map[*GraphNode]bool
+    position map[*GraphNode]int
+}
+
+// FUNCTION: NewCliqueStream
+//
+// DESCRIPTION: Returns an empty CliqueStream reporting k-cliques.
+
+func NewCliqueStream(k int) *CliqueStream {
+    stream := new(CliqueStream)
+    stream.k = k
+    stream.nodes = make(map[string]*GraphNode)
+    stream.adjacent = make(map[*GraphNode]map[*GraphNode]bool)
+    stream.position = make(map[*GraphNode]int)
+    return stream
+}
+
+// FUNCTION: Node
+//
+// DESCRIPTION: Returns the vertex of the stream labeled label,
+// creating it the first time.
+
+func (stream *CliqueStream) Node(label string) *GraphNode {
+    node, ok := stream.nodes[label]
+    if ok == false {
+        node = NewGraphNode(label, nil)
+        stream.nodes[label] = node
+        stream.adjacent[node] = make(map[*GraphNode]bool)
+        stream.position[node] = len(stream.position)
+    }
+    return node
+}
+
+// FUNCTION: AddEdge
+//
+// DESCRIPTION: Adds the edge between the vertices labeled a and b and
+// returns the k-cliques it completes: a and b together with each
+// (k-2)-clique of their common neighbors. Only the neighborhoods of a
+// and b are examined, so the cost doesn't grow with the rest of the
+// graph. An edge seen before, or from a vertex to itself, completes
+// nothing.
+
+func (stream *CliqueStream) AddEdge(a string, b string) [][]*GraphNode {
+    node_a := stream.Node(a)
+    node_b := stream.Node(b)
+    if node_a == node_b || stream.adjacent[node_a][node_b] {
+        return nil
+    }
+    AddEdge(node_a, node_b)
+    stream.adjacent[node_a][node_b] = true
+    stream.adjacent[node_b][node_a] = true
+    if stream.k < 2 {
+        return nil
+    }
+
+    var common []*GraphNode
+    for n := range stream.adjacent[node_a] {
+        if stream.adjacent[node_b][n] {
+            common = append(common, n)
+        }
+    }
+    sort.Slice(common, func(i, j int) bool {
+        return stream.position[common[i]] < stream.position[common[j]]
+    })
+
+    var cliques [][]*GraphNode
+    nodes := []*GraphNode{node_a, node_b}
+    var extend func(candidates []*GraphNode)
+    extend = func(candidates []*GraphNode) {
+        if len(nodes) == stream.k {
+            cliques = append(cliques, append([]*GraphNode{}, nodes...))
+            return
+        }
+        for i, n := range candidates {
+            var next []*GraphNode
+            for _, m := range candidates[i + 1:] {
+                if stream.adjacent[n][m] {
+                    next = append(next, m)
+                }
+            }
+            nodes = append(nodes, n)
+            extend(next)
+            nodes = nodes[:len(nodes) - 1]
+        }
+    }
+    extend(common)
+    return cliques
+}
+
+// FUNCTION: StreamEdgeCliques
+//
+// DESCRIPTION: Reads edges from r, one `source target` or
+// `source,target` line at a time (a third weight field is ignored;
+// blank and # comment lines are skipped), and writes each k-clique to
+// w as soon as the edge completing it is read, in the FprintCliques
+// format. Nothing waits for the end of the input, so r can be an
+// unbounded stream.
+
+func StreamEdgeCliques(r io.Reader, w io.Writer, k int) error {
+    stream := NewCliqueStream(k)
+    scanner := bufio.NewScanner(r)
+    line_count := 0
+    for scanner.Scan() {
+        line_count++
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        fields := strings.FieldsFunc(line, func(c rune) bool {
+            return c == ',' || unicode.IsSpace(c)
+        })
+        if len(fields) < 2 || len(fields) > 3 {
+            errstr := fmt.Sprintf("line %d: expected source target", line_count)
+            return errors.New(errstr)
+        }
+        for _, nodes := range stream.AddEdge(fields[0], fields[1]) {
+            FprintCliques(w, &Clique{nodes: nodes})
+        }
+    }
+    return scanner.Err()
+}
+
+// FUNCTION: HasCommunity
+//
+// DESCRIPTION: Reports whether CPM would find any k-community in g,
+// counting only k-cliques accepted by accept (nil accepts all). Every
+// such clique lies in a community -- on its own if no other clique
+// shares k-1 of its vertices, or together with those that do -- so the
+// answer is true as soon as StreamKCliques finds the first one, long
+// before the full enumeration would finish.
+
+func HasCommunity(g []*GraphNode, k int, accept CliqueAcceptFunc) bool {
+    accept = ExcludeVirtual(accept)
+    found := false
+    StreamKCliques(g, k, func(nodes []*GraphNode) bool {
+        if accept(nodes) {
+            found = true
+            return false
+        }
+        return true
+    })
+    return found
+}
+
+// FUNCTION: SampleCliques
+//
+// DESCRIPTION: Returns n of the k-cliques of g chosen uniformly at
+// random by reservoir sampling over StreamKCliques, so only n cliques
+// are ever held in memory. If g has no more than n k-cliques, all of
+// them are returned in the order they were generated. seed makes the
+// sample reproducible.
+
+func SampleCliques(g []*GraphNode, k int, n int, seed int64) [][]*GraphNode {
+    var sample [][]*GraphNode
+    random := rand.New(rand.NewSource(seed))
+    seen := 0
+    StreamKCliques(g, k, func(nodes []*GraphNode) bool {
+        seen++
+        if len(sample) < n {
+            sample = append(sample, append([]*GraphNode{}, nodes...))
+        } else if j := random.Intn(seen); j < n {
+            sample[j] = append([]*GraphNode{}, nodes...)
+        }
+        return true
+    })
+    return sample
+}
+
+// FUNCTION: WriteCliquesBySize
+//
+// DESCRIPTION: Writes every clique of g with at least min_k vertices
+// to dir, one file per size: cliques-3.txt holds the 3-cliques,
+// cliques-4.txt the 4-cliques and so on, up to the size of the
+// largest clique. Each file has one clique per line, as written by
+// FprintCliques, and is streamed from EachKClique. Virtual vertices
+// are left out. dir is created if it does not exist.
+
+func WriteCliquesBySize(dir string, g []*GraphNode, min_k int) error {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return err
+    }
+    var real_nodes []*GraphNode
+    for _, node := range g {
+        if node.virtual == false {
+            real_nodes = append(real_nodes, node)
+        }
+    }
+    maximal_cliques := MaximalCliques(real_nodes)
+    largest := 0
+    for _, maximal := range maximal_cliques {
+        if len(maximal) > largest {
+            largest = len(maximal)
+        }
+    }
+    if min_k < 2 {
+        min_k = 2
+    }
+
+    for k := min_k; k <= largest; k++ {
+        path := filepath.Join(dir, fmt.Sprintf("cliques-%d.txt", k))
+        file, err := os.Create(path)
+        if err != nil {
+            return err
+        }
+        writer := bufio.NewWriter(file)
+        EachKClique(maximal_cliques, k, func(nodes []*GraphNode) {
+            clique := Clique{nodes: nodes}
+            FprintCliques(writer, &clique)
+        })
+        if err := writer.Flush(); err != nil {
+            file.Close()
+            return err
+        }
+        if err := file.Close(); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// FUNCTION: CliqueKeys
+//
+// DESCRIPTION: Returns a canonical key for each clique on clique_list
+// -- its labels sorted and joined by spaces -- with the keys sorted.
+// Two clique lists with the same keys hold the same cliques.
+
+func CliqueKeys(clique_list *Clique) []string {
+    var keys []string
+    for item := clique_list; item != nil; item = item.next {
+        var labels []string
+        for _, node := range item.nodes {
+            labels = append(labels, node.label)
+        }
+        sort.Strings(labels)
+        keys = append(keys, strings.Join(labels, " "))
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// FUNCTION: Labels
+//
+// DESCRIPTION: Returns the labels of the clique's vertices.
+
+func (clique *Clique) Labels() []string {
+    return NodeLabels(clique.nodes)
+}
+
+// FUNCTION: NewClique
+//
+// DESCRIPTION: Returns a clique of the given vertices, e.g. one of
+// those returned by SampleCliques, for FprintCliques and the like.
+
+func NewClique(nodes []*GraphNode) *Clique {
+    return &Clique{nodes: nodes}
+}
+
+// FUNCTION: ID
+//
+// DESCRIPTION: Returns a stable id for the clique: "c" followed by the
+// first 12 hex digits of the SHA-256 of its sorted vertex labels. It
+// depends only on the vertices, not on their order or on how the
+// clique was found, so the same clique has the same id in every output
+// of a run and across runs, and the ids can be used to cross-reference
+// cliques between reports. (48 bits make a collision unlikely below
+// some ten million cliques.)
+
+func (clique *Clique) ID() string {
+    if clique.id == "" {
+        var labels []string
+        for _, node := range clique.nodes {
+            labels = append(labels, node.label)
+        }
+        sort.Strings(labels)
+        sum := sha256.Sum256([]byte(strings.Join(labels, "\x00")))
+        clique.id = "c" + hex.EncodeToString(sum[:])[:12]
+    }
+    return clique.id
+}
+
+// FUNCTION: CompareCliques
+//
+// DESCRIPTION: Determines whether two clique lists hold the same set
+// of cliques. If they don't, the first differing clique (in CliqueKeys
+// order) is described.
+
+func CompareCliques(a *Clique, a_name string, b *Clique, b_name string) (bool, string) {
+    a_keys := CliqueKeys(a)
+    b_keys := CliqueKeys(b)
+    i, j := 0, 0
+    for i < len(a_keys) || j < len(b_keys) {
+        switch {
+        case j >= len(b_keys) || (i < len(a_keys) && a_keys[i] < b_keys[j]):
+            return false, fmt.Sprintf("{%s} found by %s only", a_keys[i], a_name)
+        case i >= len(a_keys) || b_keys[j] < a_keys[i]:
+            return false, fmt.Sprintf("{%s} found by %s only", b_keys[j], b_name)
+        }
+        i++
+        j++
+    }
+    return true, ""
+}
+
+// FUNCTION: FilterCliques
+//
+// DESCRIPTION: Returns the cliques of clique_list for which accept
+// returns true, preserving their order. clique_list is rebuilt in
+// place; rejected cliques are unlinked.
+
+func FilterCliques(clique_list *Clique, accept CliqueAcceptFunc) *Clique {
+    return FilterCliqueList(clique_list, func(clique *Clique) bool {
+        return accept(clique.nodes)
+    })
+}
+
+// FUNCTION: CandidateEstimate
+//
+// DESCRIPTION: Returns an upper bound on the number of clique
+// candidates SearchKCliques will examine for g: GetCliqueCandidates
+// returns the distinct (k-1)-subsets of a node's neighbor list, so
+// the sum over the nodes of C(degree, k-1). It only looks at the
+// degrees, so it is instant, and a large value warns of a search
+// that will take a very long time. The sum saturates at
+// math.MaxInt64.
+
+func CandidateEstimate(g []*GraphNode, k int) int {
+    if k < 2 {
+        return 0
+    }
+    r := k - 1
+    total := 0
+    for _, node := range g {
+        n := len(node.neighbors)
+        if n < r {
+            continue
+        }
+        // C(n, r) * r must fit for the loop below not to overflow
+        lg_n, _ := math.Lgamma(float64(n + 1))
+        lg_r, _ := math.Lgamma(float64(r + 1))
+        lg_nr, _ := math.Lgamma(float64(n - r + 1))
+        if lg_n - lg_r - lg_nr + math.Log(float64(r + 1)) > math.Log(math.MaxInt64) - 1 {
+            return math.MaxInt64
+        }
+        c := 1
+        for i := 0; i < r; i++ {
+            c = c * (n - i) / (i + 1)
+        }
+        if total > math.MaxInt64 - c {
+            return math.MaxInt64
+        }
+        total += c
+    }
+    return total
+}
+
+// FUNCTION: TraceCliqueSearch
+//
+// DESCRIPTION: Writes to w how SearchKCliques treats examination_node:
+// every candidate GetCliqueCandidates returns for it, and whether
+// MakeCliqueList accepts it or why not -- the first pair of candidate
+// vertices that fails IsConnected, naming the vertex whose neighbor
+// list is missing the other -- followed by the decision of accept (nil
+// accepts all). A debugging aid for a single vertex, e.g.
+//
+//   v5: 6 candidates for k=3
+//     v3,v7: rejected: v7 doesn't list v3
+//     v3,v4: accepted, clique v3,v4,v5
+
+func TraceCliqueSearch(w io.Writer, examination_node *GraphNode, k int,
+    accept CliqueAcceptFunc) {
+
+    candidate_list := GetCliqueCandidates(k, examination_node.neighbors)
+    count := 0
+    for item := candidate_list; item != nil; item = item.next {
+        count++
+    }
+    fmt.Fprintf(w, "%s: %d candidates for k=%d\n", examination_node.label, count, k)
+    accept = ExcludeVirtual(accept)
+    for item := candidate_list; item != nil; item = item.next {
+        fmt.Fprintf(w, "  %s:", CreateLabel(item.nodes))
+        var missing [2]*GraphNode
+        for i := 0; i < len(item.nodes) && missing[0] == nil; i++ {
+            for j := i + 1; j < len(item.nodes); j++ {
+                if item.nodes[i].IsConnected(item.nodes[j]) == false {
+                    missing = [2]*GraphNode{item.nodes[i], item.nodes[j]}
+                    break
+                }
+            }
+        }
+        if missing[0] != nil {
+            fmt.Fprintf(w, " rejected: %s doesn't list %s\n", missing[1].label,
+                missing[0].label)
+            continue
+        }
+        nodes := append(append([]*GraphNode{}, item.nodes...), examination_node)
+        if accept(nodes) == false {
+            fmt.Fprintf(w, " rejected by the clique filter\n")
+            continue
+        }
+        fmt.Fprintf(w, " accepted, clique %s\n", CreateLabel(nodes))
+    }
+}
+
+// FUNCTION: FindKCliques
+//
+// DESCRIPTION: Finds every k-clique in graph (step 1 of the theory of
+// operation). Each node's neighbor list is expanded into clique
+// candidates, the candidates are checked for complete connectivity,
+// and the resulting cliques are merged into one duplicate free list.
+
+func FindKCliques(graph []*GraphNode, k int) *Clique {
+    return FindAcceptedKCliques(graph, k, nil)
+}
+
+// FUNCTION: FindAcceptedKCliques
+//
+// DESCRIPTION: Same as FindKCliques, but a k-clique is only recorded
+// if accept returns true for its vertices. This is the hook for
+// domain specific clique filters, e.g. "all members share an
+// attribute". A nil accept records every clique.
+
+func FindAcceptedKCliques(graph []*GraphNode, k int,
+    accept CliqueAcceptFunc) *Clique {
+
+    clique_list, _ := FindLimitedKCliques(graph, k, accept, Limits{})
+    return clique_list
+}
+
+// FUNCTION: FindLimitedKCliques
+//
+// DESCRIPTION: Same as FindAcceptedKCliques, but the work done is
+// bounded by limits so that a hostile graph can't consume unbounded
+// CPU or memory (e.g. when running behind an HTTP handler). The node
+// and edge limits are checked before any work is done. The clique and
+// duration limits are checked after each examination node; when one
+// is hit the cliques found so far are returned along with an error
+// that wraps ErrLimitExceeded. Note that the duration can overrun by
+// the time it takes to examine a single node.
+
+func FindLimitedKCliques(graph []*GraphNode, k int,
+    accept CliqueAcceptFunc, limits Limits) (*Clique, error) {
+
+    clique_list, _, err := FindTimedKCliques(graph, k, accept, limits)
+    return clique_list, err
+}
+
+// FUNCTION: FindTimedKCliques
+//
+// DESCRIPTION: Same as FindLimitedKCliques, but also returns how long
+// each examination node took to generate and check its clique
+// candidates. A slow run is usually caused by a few high degree
+// vertices, whose candidate lists grow exponentially; the timings
+// show which ones.
+
+func FindTimedKCliques(graph []*GraphNode, k int, accept CliqueAcceptFunc,
+    limits Limits) (*Clique, []NodeTiming, error) {
+
+    var search CliqueSearch
+    search.K = k
+    search.Accept = accept
+    search.Limits = limits
+    return SearchKCliques(graph, search)
+}
+
+// FUNCTION: CheckGraphLimits
+//
+// DESCRIPTION: Returns an error wrapping ErrLimitExceeded if graph has
+// more nodes or edges than limits allow.
+
+func CheckGraphLimits(graph []*GraphNode, limits Limits) error {
+    if limits.MaxNodes > 0 && len(graph) > limits.MaxNodes {
+        return fmt.Errorf("%d nodes exceeds maximum of %d: %w",
+            len(graph), limits.MaxNodes, ErrLimitExceeded)
+    }
+    if limits.MaxEdges > 0 {
+        edge_count := EdgeCount(graph)
+        if edge_count > limits.MaxEdges {
+            return fmt.Errorf("%d edges exceeds maximum of %d: %w",
+                edge_count, limits.MaxEdges, ErrLimitExceeded)
+        }
+    }
+    return nil
+}
+
+// FUNCTION: SearchKCliques
+//
+// DESCRIPTION: The clique search behind FindKCliques and its variants,
+// configured by search (see CliqueSearch). Besides the accept filter,
+// the limits and the timings it supports resuming an interrupted
+// search: examination starts at graph[search.Start] with the cliques
+// found by the earlier nodes in search.Cliques, and
+// search.OnCheckpoint is called every search.CheckpointEvery nodes
+// with the index of the next node and the cliques found so far.
+
+func SearchKCliques(graph []*GraphNode, search CliqueSearch) (*Clique, []NodeTiming, error) {
+    var timings []NodeTiming
+    k := search.K
+    accept := search.Accept
+    limits := search.Limits
+
+    if err := CheckGraphLimits(graph, limits); err != nil {
+        return nil, nil, err
+    }
+    if limits.MaxCandidates > 0 {
+        estimate := CandidateEstimate(graph[search.Start:], k)
+        if estimate > limits.MaxCandidates {
+            return nil, nil, fmt.Errorf("%d clique candidates exceeds maximum of %d: %w",
+                estimate, limits.MaxCandidates, ErrLimitExceeded)
+        }
+    }
+
+    start := time.Now()
+    var clique_list *Clique = search.Cliques
+    for i := search.Start; i < len(graph); i++ {
+        node := graph[i]
+        node_start := time.Now()
+        candidate_list := GetCliqueCandidates(k, node.neighbors)
+        if candidate_list != nil {
+            temp_clique_list := MakeCliqueList(candidate_list, node)
+            if accept != nil {
+                temp_clique_list = FilterCliques(temp_clique_list, accept)
+            }
+            if clique_list == nil {
+                clique_list = temp_clique_list
+            } else {
+                clique_list = MergeCliques(clique_list, temp_clique_list)
+            }
+        }
+        timings = append(timings, NodeTiming{node, time.Since(node_start)})
+        if limits.MaxCliques > 0 {
+            if clique_count := CountCliques(clique_list); clique_count > limits.MaxCliques {
+                clique_list = TruncateCliques(clique_list, limits.MaxCliques)
+                return clique_list, timings, fmt.Errorf("more than %d cliques: %w",
+                    limits.MaxCliques, ErrLimitExceeded)
+            }
+        }
+        if limits.MaxDuration > 0 && time.Since(start) > limits.MaxDuration {
+            return clique_list, timings, fmt.Errorf("clique search exceeded %v: %w",
+                limits.MaxDuration, ErrLimitExceeded)
+        }
+        if search.OnCheckpoint != nil && search.CheckpointEvery > 0 &&
+            (i + 1) % search.CheckpointEvery == 0 && i + 1 < len(graph) {
+            if err := search.OnCheckpoint(i + 1, clique_list); err != nil {
+                return clique_list, timings, err
+            }
+        }
+    }
+    return clique_list, timings, nil
+}
+
+// FUNCTION: UpdateCliques
+//
+// DESCRIPTION: Adds added_edges to g as undirected edges and returns
+// clique_list (the k-cliques of g before the additions) updated with
+// the new k-cliques, without rescanning the whole graph. Adding edges
+// can't destroy a clique, and every new k-clique must contain at
+// least one added edge (u, v) plus k-2 vertices that are common
+// neighbors of u and v. So only those common neighborhoods are
+// searched, and what is found is merged into clique_list without
+// duplicates.
+
+func UpdateCliques(g []*GraphNode, clique_list *Clique,
+    added_edges [][2]*GraphNode, k int) *Clique {
+
+    for _, edge := range added_edges {
+        AddEdge(edge[0], edge[1])
+    }
+    if k < 2 {
+        return clique_list
+    }
+
+    for _, edge := range added_edges {
+        u, v := edge[0], edge[1]
+        if u == v {
+            continue
+        }
+        var new_cliques *Clique = nil
+        if k == 2 {
+            new_cliques = new(Clique)
+            new_cliques.nodes = []*GraphNode{u, v}
+        } else {
+            var common []*GraphNode
+            for _, n := range u.neighbors {
+                if n != v && n.IsConnected(v) {
+                    common = append(common, n)
+                }
+            }
+            candidate_list := GetCliqueCandidates(k - 1, common)
+            new_cliques = MakeCliqueList(candidate_list, u)
+            for item := new_cliques; item != nil; item = item.next {
+                item.nodes = append(item.nodes, v)
+            }
+        }
+        if clique_list == nil {
+            clique_list = new_cliques
+        } else {
+            clique_list = MergeCliques(clique_list, new_cliques)
+        }
+    }
+    return clique_list
+}
+
+// FUNCTION: SlowestNodes
+//
+// DESCRIPTION: Returns the n entries of timings that took longest,
+// slowest first.
+
+func SlowestNodes(timings []NodeTiming, n int) []NodeTiming {
+    sorted := make([]NodeTiming, len(timings))
+    copy(sorted, timings)
+    sort.SliceStable(sorted, func(i, j int) bool {
+        return sorted[i].Duration > sorted[j].Duration
+    })
+    if n < len(sorted) {
+        sorted = sorted[:n]
+    }
+    return sorted
+}
+
+// FUNCTION: WriteCheckpoint
+//
+// DESCRIPTION: Saves the state of a clique search on g, about to
+// examine g[next], to path. The file is written under a temporary
+// name and renamed into place so an interruption can't leave a
+// truncated checkpoint behind.
+
+func WriteCheckpoint(path string, g []*GraphNode, k int, next int,
+    clique_list *Clique) error {
+
+    var checkpoint Checkpoint
+    checkpoint.K = k
+    checkpoint.Nodes = len(g)
+    checkpoint.Next = next
+    checkpoint.Cliques = [][]string{}
+    for item := clique_list; item != nil; item = item.next {
+        var labels []string
+        for _, node := range item.nodes {
+            labels = append(labels, node.label)
+        }
+        checkpoint.Cliques = append(checkpoint.Cliques, labels)
+    }
+    data, err := json.Marshal(&checkpoint)
+    if err != nil {
+        return err
+    }
+    temp_path := path + ".tmp"
+    if err := os.WriteFile(temp_path, data, 0644); err != nil {
+        return err
+    }
+    return os.Rename(temp_path, path)
+}
+
+// FUNCTION: ReadCheckpoint
+//
+// DESCRIPTION: Loads a checkpoint written by WriteCheckpoint for a
+// search on g with clique size k, and returns the index of the next
+// node to examine and the cliques found so far. The checkpoint must
+// come from the same graph, k and options, or an error is returned.
+
+func ReadCheckpoint(path string, g []*GraphNode, k int) (int, *Clique, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return 0, nil, err
+    }
+    var checkpoint Checkpoint
+    if err := json.Unmarshal(data, &checkpoint); err != nil {
+        return 0, nil, fmt.Errorf("%s: %v", path, err)
+    }
+    if checkpoint.K != k || checkpoint.Nodes != len(g) ||
+        checkpoint.Next < 0 || checkpoint.Next > len(g) {
+        errstr := fmt.Sprintf("%s: checkpoint doesn't match this graph and k", path)
+        return 0, nil, errors.New(errstr)
+    }
+
+    var head *Clique = nil
+    var tail *Clique = nil
+    for _, labels := range checkpoint.Cliques {
+        clique := new(Clique)
+        nodes, err := SelectNodes(g, labels)
+        if err != nil {
+            return 0, nil, fmt.Errorf("%s: %v", path, err)
+        }
+        clique.nodes = nodes
+        if tail == nil {
+            head = clique
+        } else {
+            tail.next = clique
+        }
+        tail = clique
+    }
+    return checkpoint.Next, head, nil
+}
+
+// FUNCTION: VerifyCliques
+//
+// DESCRIPTION: A defensive self-test of the clique search. Every pair
+// of vertices in every accepted clique is re-checked for an edge in
+// both directions, which is what a clique means in an undirected
+// graph. MakeCliqueList only checks each pair in one direction, so a
+// file that is really directed (e.g. `v1: v2` without `v2: v1`) can
+// yield cliques that aren't. A description of each failing pair is
+// returned; an empty result means every clique checked out.
+
+func VerifyCliques(clique_list *Clique) []string {
+    var problems []string
+    for item := clique_list; item != nil; item = item.next {
+        for i, a := range item.nodes {
+            for _, b := range item.nodes[i + 1:] {
+                if a.IsConnected(b) == false || b.IsConnected(a) == false {
+                    problem := fmt.Sprintf("clique %s: %s and %s are not connected in both directions",
+                        CreateLabel(item.nodes), a.label, b.label)
+                    problems = append(problems, problem)
+                }
+            }
+        }
+    }
+    return problems
+}
+
+// FUNCTION: Intensity
+//
+// DESCRIPTION: Returns the intensity of the clique formed by nodes:
+// the geometric mean of the weights of its edges. This is the measure
+// used by the weighted clique percolation method (CPMw), where only
+// cliques whose intensity exceeds a threshold take part in
+// percolation. An edge missing from a to b contributes its weight
+// from b to a.
+
+func Intensity(nodes []*GraphNode) float64 {
+    log_sum := 0.0
+    edge_count := 0
+    for i, a := range nodes {
+        for _, b := range nodes[i + 1:] {
+            weight := EdgeWeight(a, b)
+            if weight == 0 {
+                weight = EdgeWeight(b, a)
+            }
+            log_sum += math.Log(weight)
+            edge_count++
+        }
+    }
+    if edge_count == 0 {
+        return 0
+    }
+    return math.Exp(log_sum / float64(edge_count))
+}
+
+// FUNCTION: IntensityPredicate
+//
+// DESCRIPTION: Returns the CPMw clique filter: a clique is accepted
+// only if its intensity exceeds threshold.
+
+func IntensityPredicate(threshold float64) CliqueAcceptFunc {
+    return func(nodes []*GraphNode) bool {
+        return Intensity(nodes) > threshold
+    }
+}
+
+// FUNCTION: DropContainedCliques
+//
+// DESCRIPTION: Removes every clique whose vertices are a proper subset
+// of another clique on clique_list, so the community graph doesn't get
+// a redundant node for it. A plain k-clique search can't produce such
+// pairs, since all its cliques have k vertices; they arise when
+// cliques of different sizes are combined (e.g. when sweeping k or
+// listing maximal cliques). Don't use it when every clique should
+// count on its own, e.g. when clique counts per size matter.
+
+func DropContainedCliques(clique_list *Clique) *Clique {
+    contained := make(map[*Clique]bool)
+    for item := clique_list; item != nil; item = item.next {
+        for other := clique_list; other != nil; other = other.next {
+            if other != item && len(other.nodes) > len(item.nodes) &&
+                IsSubset(item.nodes, other.nodes) {
+                contained[item] = true
+                break
+            }
+        }
+    }
+    return FilterCliqueList(clique_list, func(clique *Clique) bool {
+        return contained[clique] == false
+    })
+}
+
+// FUNCTION: FilterCliqueList
+//
+// DESCRIPTION: Like FilterCliques, but keep is given the whole clique
+// rather than just its vertices.
+
+func FilterCliqueList(clique_list *Clique, keep func(*Clique) bool) *Clique {
+    var head *Clique = nil
+    var tail *Clique = nil
+    for item := clique_list; item != nil; {
+        next := item.next
+        item.next = nil
+        if keep(item) {
+            if tail == nil {
+                head = item
+            } else {
+                tail.next = item
+            }
+            tail = item
+        }
+        item = next
+    }
+    return head
+}
+
+// FUNCTION: IsSubset
+//
+// DESCRIPTION: Determines whether every vertex of a is also in b.
+
+func IsSubset(a []*GraphNode, b []*GraphNode) bool {
+    for _, node := range a {
+        found := false
+        for _, other := range b {
+            if node == other {
+                found = true
+                break
+            }
+        }
+        if found == false {
+            return false
+        }
+    }
+    return true
+}
+
+// FUNCTION: Binomial
+//
+// DESCRIPTION: Returns the number of k-subsets of n elements, which is
+// the number of k-cliques of a complete graph of n vertices, or
+// math.MaxInt64 if that does not fit.
+
+func Binomial(n int, k int) int {
+    if k < 0 || k > n {
+        return 0
+    }
+    if k > n - k {
+        k = n - k
+    }
+    c := 1
+    for i := 0; i < k; i++ {
+        // c is C(n, i), so c * (n - i) / (i + 1) is exactly C(n, i + 1)
+        if c > math.MaxInt64 / (n - i) {
+            return math.MaxInt64
+        }
+        c = c * (n - i) / (i + 1)
+    }
+    return c
+}
+
+// FUNCTION: CountCliques
+//
+// DESCRIPTION: Returns the number of cliques on clique_list.
+
+func CountCliques(clique_list *Clique) int {
+    count := 0
+    for item := clique_list; item != nil; item = item.next {
+        count++
+    }
+    return count
+}
+
+// FUNCTION: TruncateCliques
+//
+// DESCRIPTION: Cuts clique_list after its first n cliques and
+// returns it.
+
+func TruncateCliques(clique_list *Clique, n int) *Clique {
+    if n <= 0 {
+        return nil
+    }
+    item := clique_list
+    for i := 1; item != nil && i < n; i++ {
+        item = item.next
+    }
+    if item != nil {
+        item.next = nil
+    }
+    return clique_list
+}
+
+// FUNCTION: Edges
+//
+// DESCRIPTION: Returns the distinct edges of g in the order they are
+// first seen. A pair of vertices that lists each other as neighbors
+// is a single edge.
+
+func Edges(g []*GraphNode) [][2]*GraphNode {
+    var edges [][2]*GraphNode
+    seen := make(map[[2]*GraphNode]bool)
+    for _, node := range g {
+        for _, n := range node.neighbors {
+            if seen[[2]*GraphNode{n, node}] == false &&
+                seen[[2]*GraphNode{node, n}] == false {
+                seen[[2]*GraphNode{node, n}] = true
+                edges = append(edges, [2]*GraphNode{node, n})
+            }
+        }
+    }
+    return edges
+}
+
+// FUNCTION: EdgeCount
+//
+// DESCRIPTION: Returns the number of distinct edges in g.
+
+func EdgeCount(g []*GraphNode) int {
+    return len(Edges(g))
+}
+
+// FUNCTION: WeightQuantiles
+//
+// DESCRIPTION: Returns the minimum, 25th percentile, median, 75th
+// percentile and maximum of the edge weights of g, taken over its
+// distinct undirected edges. Quantiles between two weights are
+// linearly interpolated. Returns nil if g has no edges.
+
+func WeightQuantiles(g []*GraphNode) []float64 {
+    var weights []float64
+    for _, edge := range Edges(g) {
+        weights = append(weights, EdgeWeight(edge[0], edge[1]))
+    }
+    if len(weights) == 0 {
+        return nil
+    }
+    sort.Float64s(weights)
+    var quantiles []float64
+    for _, q := range []float64{0, 0.25, 0.5, 0.75, 1} {
+        position := q * float64(len(weights) - 1)
+        i := int(math.Floor(position))
+        value := weights[i]
+        if i + 1 < len(weights) {
+            value += (position - float64(i)) * (weights[i + 1] - weights[i])
+        }
+        quantiles = append(quantiles, value)
+    }
+    return quantiles
+}
+
+// FUNCTION: CreateLabel
+//
+// DESCRIPTION: Generates a label for a node in the community
+// graph. It does this by concatening the labels of each vertex from
+// the origial graph that is in a clique to a single label name.
+
+func CreateLabel (nodes []*GraphNode) string {
+    var new_label string
+    for i,item := range nodes {
+        if i == 0 {
+            new_label = item.label
+        } else {
+            new_label += "," + item.label
+        }
+    }
+    return new_label
+}
+
+// FUNCTION: Kminu1CommonNodes
+//
+// DESCRIPTION: Determines if two nodes on the newly created
+// community graph share k-1 vertices from the original graph. If
+// so, then there should be an edge from gn and node in the
+// community graph.
+
+func Kminus1CommonNodes (gn *GraphNode, node *GraphNode, k int) bool {
+    common_node_count := 0
+    return_value := false
+
+    for _, exam_node := range gn.associated_clique.nodes {
+        for _, common_node := range node.associated_clique.nodes {
+            if exam_node == common_node {
+                common_node_count++
+                if common_node_count == k - 1 {
+                    return true
+                }
+            }
+        }
+    }
+    return return_value
+}
+
+// FUNCTION: CheckCommunityGraph
+//
+// DESCRIPTION: Returns an error naming the first node of
+// community_graph, or of one of their neighbor lists, that has no
+// associated clique. Every community graph node needs one: it is what
+// Kminus1CommonNodes compares and what a community is made of. A
+// missing link is a bug in whatever built the graph, and can't be
+// repaired here since the clique is gone, so Run checks for one
+// rather than crash or report a wrong community later.
+
+func CheckCommunityGraph(community_graph []*GraphNode) error {
+    dangling := func(node *GraphNode) bool {
+        return node.associated_clique == nil || len(node.associated_clique.nodes) == 0
+    }
+    for i, node := range community_graph {
+        if dangling(node) {
+            errstr := fmt.Sprintf("community graph node %d (%s): no associated clique",
+                i + 1, node.label)
+            return errors.New(errstr)
+        }
+        for _, n := range node.neighbors {
+            if dangling(n) {
+                errstr := fmt.Sprintf("community graph node %d (%s): neighbor %s has no associated clique",
+                    i + 1, node.label, n.label)
+                return errors.New(errstr)
+            }
+        }
+    }
+    return nil
+}
+
+// FUNCTION: AddNeighbors
+//
+// DESCRIPTION: Determines whether there is an edge between two
+// nodes in the generated community graph. If there is, that edge is
+// recorded as one of gn's neighbors.
+
+func AddNeighbors (graph []*GraphNode, gn *GraphNode, k int) {
+    for _, node := range graph {
+        if gn != node && Kminus1CommonNodes(gn, node, k) {
+            AddNeighbor(gn, node)
+        }
+    }
+}
+
+// FUNCTION: CreateCommunityGraph
+//
+// DESCRIPTION: Transforms every clique created from the original
+// graph into a node in the community graph. CreateCommunityGraph
+// also determines if there is an edge between vertices and adds the
+// appropriate neighbor nodes. For the nodes in the community graph
+// to be connected, they must have k-1 vertices in
+// common. CreateCommunityGraph returns a valid community graph for
+// k.
+
+func CreateCommunityGraph (clique_list *Clique, k int) []*GraphNode {
+    var community_graph []*GraphNode
+    if clique_list == nil {
+        return nil
+    }
+    for item := clique_list; item != nil; item = item.next {
+        label := CreateLabel (item.nodes)
+        new_node := NewGraphNode(label, item)
+        community_graph = append(community_graph, new_node)
+    }
+
+    for _, node := range community_graph {
+        AddNeighbors(community_graph, node, k)
+    }
+    UniqueLabels(community_graph)
+    
+    return community_graph
+}
+
+// FUNCTION: CreateCommunityGraphParallel
+//
+// DESCRIPTION: Same as CreateCommunityGraph, but the pairwise k-1
+// overlap test, which is where the time goes, is shared between jobs
+// goroutines. Each goroutine fills in the neighbor lists of the nodes
+// it is handed and only reads the cliques of the others, and every
+// list is still built in community graph order, so the result is the
+// same as CreateCommunityGraph's.
+
+func CreateCommunityGraphParallel(clique_list *Clique, k int, jobs int) []*GraphNode {
+    if jobs < 2 {
+        return CreateCommunityGraph(clique_list, k)
+    }
+    var community_graph []*GraphNode
+    for item := clique_list; item != nil; item = item.next {
+        label := CreateLabel(item.nodes)
+        community_graph = append(community_graph, NewGraphNode(label, item))
+    }
+
+    next := make(chan *GraphNode)
+    var wg sync.WaitGroup
+    for j := 0; j < jobs; j++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for node := range next {
+                AddNeighbors(community_graph, node, k)
+            }
+        }()
+    }
+    for _, node := range community_graph {
+        next <- node
+    }
+    close(next)
+    wg.Wait()
+    UniqueLabels(community_graph)
+    return community_graph
+}
+
+// FUNCTION: UniqueLabels
+//
+// DESCRIPTION: Makes the labels of g distinct by appending "#2", "#3"
+// and so on to repeats of a label. CreateLabel can give two different
+// cliques the same label when vertex labels contain commas (which the
+// csv, json and tgf formats allow), e.g. {"a,b", "c"} and {"a", "b,c"}.
+// The community graph is only ever traversed by pointer, so a
+// collision can't merge the cliques, but output such as DOT names
+// nodes by label and would.
+
+func UniqueLabels(g []*GraphNode) {
+    used := make(map[string]bool)
+    for _, node := range g {
+        used[node.label] = true
+    }
+    seen := make(map[string]bool)
+    for _, node := range g {
+        if seen[node.label] == false {
+            seen[node.label] = true
+            continue
+        }
+        for n := 2; ; n++ {
+            label := fmt.Sprintf("%s#%d", node.label, n)
+            if used[label] == false {
+                used[label] = true
+                seen[label] = true
+                node.label = label
+                break
+            }
+        }
+    }
+}
+
+// FUNCTION: CreateMixedCommunityGraph
+//
+// DESCRIPTION: Same as CreateCommunityGraph, but for a clique list
+// mixing cliques of different sizes: a ki-clique and a kj-clique are
+// connected when they share at least min(ki, kj)-1 vertices. When
+// every clique has size k this is the usual k-1 rule.
+
+func CreateMixedCommunityGraph(clique_list *Clique) []*GraphNode {
+    var community_graph []*GraphNode
+    for item := clique_list; item != nil; item = item.next {
+        label := CreateLabel(item.nodes)
+        community_graph = append(community_graph, NewGraphNode(label, item))
+    }
+
+    for _, node := range community_graph {
+        for _, other := range community_graph {
+            if other == node {
+                continue
+            }
+            size := len(node.associated_clique.nodes)
+            if len(other.associated_clique.nodes) < size {
+                size = len(other.associated_clique.nodes)
+            }
+            if len(SharedVertices(node, other)) >= size - 1 {
+                AddNeighbor(node, other)
+            }
+        }
+    }
+    UniqueLabels(community_graph)
+    return community_graph
+}
+
+// FUNCTION: CommunityComponents
+//
+// DESCRIPTION: Returns the connected components of the community
+// graph. Each component is a list of community graph nodes (cliques)
+// in breadth first order from the first node of the component.
+
+func CommunityComponents(community_graph []*GraphNode) [][]*GraphNode {
+    var components [][]*GraphNode
+    visited := make(map[*GraphNode]bool)
+
+    for _, start := range community_graph {
+        if visited[start] {
+            continue
+        }
+        var component []*GraphNode
+        queue := []*GraphNode{start}
+        visited[start] = true
+        for len(queue) > 0 {
+            node := queue[0]
+            queue = queue[1:]
+            component = append(component, node)
+            for _, n := range node.neighbors {
+                if visited[n] == false {
+                    visited[n] = true
+                    queue = append(queue, n)
+                }
+            }
+        }
+        components = append(components, component)
+    }
+    return components
+}
+
+// FUNCTION: FindCommunities
+//
+// DESCRIPTION: Implements step 4 of the theory of operation: each
+// connected component of the community graph is a community. Every
+// component found by CommunityComponents is flattened back into the
+// vertices of the original graph covered by its cliques. A vertex
+// that belongs to cliques in two different components is reported in
+// both communities, which is how CPM expresses overlap. For the Model
+// Graph with k=3 this yields {v1, v2, v3}, {v3, ..., v8} and
+// {v8, v9, v10}.
+
+func FindCommunities(community_graph []*GraphNode) [][]*GraphNode {
+    var communities [][]*GraphNode
+    for _, component := range CommunityComponents(community_graph) {
+        communities = append(communities, ComponentVertices(component))
+    }
+    return communities
+}
+
+// FUNCTION: ComponentVertices
+//
+// DESCRIPTION: Flattens a component of the community graph into the
+// original graph vertices covered by its cliques, each once, in the
+// order they are first met.
+
+func ComponentVertices(component []*GraphNode) []*GraphNode {
+    var community []*GraphNode
+    in_community := make(map[*GraphNode]bool)
+    for _, node := range component {
+        for _, vertex := range node.associated_clique.nodes {
+            if in_community[vertex] == false {
+                in_community[vertex] = true
+                community = append(community, vertex)
+            }
+        }
+    }
+    return community
+}
+
+// FUNCTION: FindCommunitiesParallel
+//
+// DESCRIPTION: Same as FindCommunities, but the components are
+// flattened by jobs goroutines at once. Communities never span
+// components, so each component is independent; the result is in the
+// same order as FindCommunities' whatever order the goroutines finish
+// in. This pays off on community graphs with many large components.
+
+func FindCommunitiesParallel(community_graph []*GraphNode, jobs int) [][]*GraphNode {
+    components := CommunityComponents(community_graph)
+    if jobs < 2 || len(components) < 2 {
+        return FindCommunities(community_graph)
+    }
+    communities := make([][]*GraphNode, len(components))
+    next := make(chan int)
+    var wg sync.WaitGroup
+    for j := 0; j < jobs; j++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range next {
+                communities[i] = ComponentVertices(components[i])
+            }
+        }()
+    }
+    for i := range components {
+        next <- i
+    }
+    close(next)
+    wg.Wait()
+    return communities
+}
+
+// FUNCTION: SharedVertices
+//
+// DESCRIPTION: Returns the original graph vertices that the cliques
+// behind two community graph nodes have in common.
+
+func SharedVertices(a *GraphNode, b *GraphNode) []*GraphNode {
+    var shared []*GraphNode
+    for _, vertex := range b.associated_clique.nodes {
+        for _, other := range a.associated_clique.nodes {
+            if vertex == other {
+                shared = append(shared, vertex)
+                break
+            }
+        }
+    }
+    return shared
+}
+
+// MERGED_COMPONENT stands in CPMResult.Components for a community made
+// by MergeSimilarCommunities from several components.
+const MERGED_COMPONENT = -1
+
+// FUNCTION: ExplainCommunity
+//
+// DESCRIPTION: Writes the chain of overlapping cliques that
+// percolates the community with the given id together. This is a
+// breadth first spanning tree of the community's component in the
+// community graph: the first line is the root clique and every other
+// line links a clique to the clique it was reached from, annotated
+// with the k-1 (or more) vertices they share. Each clique is followed
+// by its ID. For community 2 of the Model Graph, for example:
+//
+//   v4,v5,v3 [c23e1aa0550e5]
+//   v4,v5,v3 [c23e1aa0550e5] -- v5,v7,v4 [c71f716e5c5d7] (shared: v5 v4)
+//   ...
+//
+// The component is found through result.Components, so id is the
+// printed community id even after merging and sorting. A community
+// merged from several components has no single chain, which is an
+// error, as is a result without a community graph.
+
+func ExplainCommunity(w io.Writer, result *CPMResult, id int) error {
+    if id < 1 || id > len(result.Communities) {
+        errstr := fmt.Sprintf("community %d: doesn't exist", id)
+        return errors.New(errstr)
+    }
+    if result.CliquesSkipped {
+        errstr := fmt.Sprintf("community %d: the clique search was skipped for a complete graph, so there is no clique chain", id)
+        return errors.New(errstr)
+    }
+    if result.Components == nil {
+        errstr := fmt.Sprintf("community %d: the result has no community graph", id)
+        return errors.New(errstr)
+    }
+    if result.Components[id - 1] == MERGED_COMPONENT {
+        errstr := fmt.Sprintf("community %d: merged from several communities, so no single clique chain percolates it", id)
+        return errors.New(errstr)
+    }
+    component := CommunityComponents(result.CommunityGraph)[result.Components[id - 1]]
+
+    fmt.Fprintf(w, "Community %d percolates through %d cliques:\n",
+        id, len(component))
+    root := component[0]
+    fmt.Fprintf(w, "  %s [%s]\n", root.label, root.associated_clique.ID())
+    visited := map[*GraphNode]bool{root: true}
+    queue := []*GraphNode{root}
+    for len(queue) > 0 {
+        node := queue[0]
+        queue = queue[1:]
+        for _, n := range node.neighbors {
+            if visited[n] {
+                continue
+            }
+            visited[n] = true
+            queue = append(queue, n)
+            fmt.Fprintf(w, "  %s [%s] -- %s [%s] (shared:", node.label,
+                node.associated_clique.ID(), n.label, n.associated_clique.ID())
+            for _, vertex := range SharedVertices(node, n) {
+                fmt.Fprintf(w, " %s", vertex.label)
+            }
+            fmt.Fprintf(w, ")\n")
+        }
+    }
+    return nil
+}
+
+// FUNCTION: UncoveredVertices
+//
+// DESCRIPTION: Returns the vertices of the graph, in graph order, that
+// belong to no community of result. Virtual vertices are left out.
+
+func UncoveredVertices(result *CPMResult) []*GraphNode {
+    var uncovered []*GraphNode
+    for _, node := range result.Graph {
+        if node.virtual == false && result.Membership[node.label] == nil {
+            uncovered = append(uncovered, node)
+        }
+    }
+    return uncovered
+}
+
+// FUNCTION: ExplainUncovered
+//
+// DESCRIPTION: Writes to w, for every uncovered vertex, why no
+// community covers it:
+//
+//   - its degree is below k-1, so it can't be in a k-clique;
+//   - its degree is high enough, but its neighbors aren't connected
+//     enough for it to be in any k-clique; or
+//   - it is in k-cliques of the graph, but every one of them was
+//     rejected by the clique filter (e.g. -w or a virtual vertex).
+//
+// In plain CPM every k-clique is at least a community of its own, so
+// a vertex in an accepted k-clique is always covered.
+
+func ExplainUncovered(w io.Writer, result *CPMResult) {
+    uncovered := UncoveredVertices(result)
+    fmt.Fprintf(w, "%d uncovered vertices:\n", len(uncovered))
+    if len(uncovered) == 0 {
+        return
+    }
+    in_k_clique := make(map[*GraphNode]bool)
+    for _, maximal := range MaximalCliques(result.Graph) {
+        if len(maximal) >= result.K {
+            for _, node := range maximal {
+                in_k_clique[node] = true
+            }
+        }
+    }
+    for _, node := range uncovered {
+        degree := 0
+        seen := make(map[*GraphNode]bool)
+        for _, n := range node.neighbors {
+            if n != node && seen[n] == false {
+                seen[n] = true
+                degree++
+            }
+        }
+        switch {
+        case degree < result.K - 1:
+            fmt.Fprintf(w, "  %s: degree %d is below k-1 = %d\n", node.label,
+                degree, result.K - 1)
+        case in_k_clique[node] == false:
+            fmt.Fprintf(w, "  %s: degree %d, but in no %d-clique\n", node.label,
+                degree, result.K)
+        default:
+            fmt.Fprintf(w, "  %s: its %d-cliques were all rejected by the clique filter\n",
+                node.label, result.K)
+        }
+    }
+}
+
+// FUNCTION: Jaccard
+//
+// DESCRIPTION: Returns the Jaccard similarity of two vertex sets: the
+// size of their intersection divided by the size of their union.
+
+func Jaccard(a []*GraphNode, b []*GraphNode) float64 {
+    in_a := make(map[*GraphNode]bool)
+    for _, node := range a {
+        in_a[node] = true
+    }
+    intersection := 0
+    union := len(in_a)
+    in_b := make(map[*GraphNode]bool)
+    for _, node := range b {
+        if in_b[node] {
+            continue
+        }
+        in_b[node] = true
+        if in_a[node] {
+            intersection++
+        } else {
+            union++
+        }
+    }
+    if union == 0 {
+        return 0
+    }
+    return float64(intersection) / float64(union)
+}
+
+// FUNCTION: MergeSimilarCommunities
+//
+// DESCRIPTION: CPM can produce communities that differ by a single
+// vertex. This post-processing step repeatedly replaces the first
+// pair of communities whose Jaccard similarity exceeds threshold
+// with their union (kept in the position of the earlier community)
+// until no pair exceeds it. components, if not nil, holds the
+// community graph component of each community (see
+// CPMResult.Components); it is kept in step and returned, with
+// MERGED_COMPONENT for every union.
+
+func MergeSimilarCommunities(communities [][]*GraphNode, components []int,
+    threshold float64) ([][]*GraphNode, []int) {
+
+    merged := true
+    for merged {
+        merged = false
+        for i := 0; i < len(communities) && merged == false; i++ {
+            for j := i + 1; j < len(communities); j++ {
+                if Jaccard(communities[i], communities[j]) > threshold {
+                    communities[i] = UnionNodes(communities[i], communities[j])
+                    communities = append(communities[:j], communities[j + 1:]...)
+                    if components != nil {
+                        components[i] = MERGED_COMPONENT
+                        components = append(components[:j], components[j + 1:]...)
+                    }
+                    merged = true
+                    break
+                }
+            }
+        }
+    }
+    return communities, components
+}
+
+// FUNCTION: UnionNodes
+//
+// DESCRIPTION: Returns the vertices of a followed by those of b that
+// are not already in a.
+
+func UnionNodes(a []*GraphNode, b []*GraphNode) []*GraphNode {
+    result := append([]*GraphNode{}, a...)
+    for _, node := range b {
+        found := false
+        for _, existing := range result {
+            if existing == node {
+                found = true
+                break
+            }
+        }
+        if found == false {
+            result = append(result, node)
+        }
+    }
+    return result
+}
+
+// FUNCTION: VertexWeight
+//
+// DESCRIPTION: Returns the total vertex weight of a community.
+
+func VertexWeight(community []*GraphNode) float64 {
+    total := 0.0
+    for _, node := range community {
+        total += node.vertex_weight
+    }
+    return total
+}
+
+// FUNCTION: Conductance
+//
+// DESCRIPTION: Returns the conductance of community within g, a
+// standard cut based measure of community quality: the number of
+// boundary edges (one endpoint inside, one outside) divided by the
+// volume of the community, i.e. 2 * internal edges + boundary edges.
+// Lower is better. A community with no boundary, such as one equal to
+// the whole graph, has conductance 0, as does one with no edges.
+
+func Conductance(g []*GraphNode, community []*GraphNode) float64 {
+    in_community := make(map[*GraphNode]bool)
+    for _, node := range community {
+        in_community[node] = true
+    }
+    internal := 0
+    boundary := 0
+    for _, edge := range Edges(g) {
+        a := in_community[edge[0]]
+        b := in_community[edge[1]]
+        if a && b {
+            internal++
+        } else if a || b {
+            boundary++
+        }
+    }
+    volume := 2 * internal + boundary
+    if boundary == 0 || volume == 0 {
+        return 0
+    }
+    return float64(boundary) / float64(volume)
+}
+
+// FUNCTION: CommunityDensity
+//
+// DESCRIPTION: Returns the internal edge density of community within
+// g: the fraction of the possible edges among its members that are
+// edges of g. A community that is a single clique has density 1; the
+// lower it is, the less clique-like the community is as a whole.
+
+func CommunityDensity(g []*GraphNode, community []*GraphNode) float64 {
+    in_community := make(map[*GraphNode]bool)
+    for _, node := range community {
+        in_community[node] = true
+    }
+    n := len(in_community)
+    if n < 2 {
+        return 0
+    }
+    internal := 0
+    for _, edge := range Edges(g) {
+        if edge[0] != edge[1] && in_community[edge[0]] && in_community[edge[1]] {
+            internal++
+        }
+    }
+    return 2 * float64(internal) / float64(n * (n - 1))
+}
+
+// FUNCTION: Modularity
+//
+// DESCRIPTION: Returns the modularity of communities within g: for
+// each community, the fraction of g's edges inside it less the
+// fraction expected at random given its members' degrees, summed.
+// Overlapping communities are simply summed, so a vertex counts in
+// every community it belongs to. Higher is better; a graph with no
+// edges has modularity 0.
+
+func Modularity(g []*GraphNode, communities [][]*GraphNode) float64 {
+    edges := Edges(g)
+    if len(edges) == 0 {
+        return 0
+    }
+    degree := make(map[*GraphNode]int)
+    for _, edge := range edges {
+        degree[edge[0]]++
+        degree[edge[1]]++
+    }
+    m := float64(len(edges))
+    q := 0.0
+    for _, community := range communities {
+        in_community := make(map[*GraphNode]bool)
+        total_degree := 0
+        for _, node := range community {
+            if in_community[node] == false {
+                in_community[node] = true
+                total_degree += degree[node]
+            }
+        }
+        internal := 0
+        for _, edge := range edges {
+            if in_community[edge[0]] && in_community[edge[1]] {
+                internal++
+            }
+        }
+        fraction := float64(total_degree) / (2 * m)
+        q += float64(internal) / m - fraction * fraction
+    }
+    return q
+}
+
+// FUNCTION: Coverage
+//
+// DESCRIPTION: Returns the fraction of the vertices of g that belong
+// to at least one of communities.
+
+func Coverage(g []*GraphNode, communities [][]*GraphNode) float64 {
+    if len(g) == 0 {
+        return 0
+    }
+    covered := make(map[*GraphNode]bool)
+    for _, community := range communities {
+        for _, node := range community {
+            covered[node] = true
+        }
+    }
+    return float64(len(covered)) / float64(len(g))
+}
+
+// KScore is one row of a ValidateKRange sweep.
+type KScore struct {
+    K int
+    Communities int
+    Score float64
+}
+
+// FUNCTION: ValidateKRange
+//
+// DESCRIPTION: Runs CPM with opts for every k from lo to hi and scores
+// each partition by criterion: "modularity", "coverage" (see Modularity
+// and Coverage) or "count", the number of communities. Returns the
+// scores of all the k and the k with the highest score, the smallest
+// such k on a tie. opts.MixedK is ignored.
+
+func ValidateKRange(g []*GraphNode, opts Options, lo int, hi int, criterion string) (int, []KScore, error) {
+    switch criterion {
+    case "modularity", "coverage", "count":
+    default:
+        errstr := fmt.Sprintf("%s: unknown criterion", criterion)
+        return 0, nil, errors.New(errstr)
+    }
+    if lo < 2 || hi < lo {
+        errstr := fmt.Sprintf("%d-%d: invalid k range", lo, hi)
+        return 0, nil, errors.New(errstr)
+    }
+    opts.MixedK = nil
+    var scores []KScore
+    best := 0
+    for k := lo; k <= hi; k++ {
+        opts.K = k
+        result, err := Run(g, opts)
+        if err != nil {
+            return 0, scores, err
+        }
+        var score KScore
+        score.K = k
+        score.Communities = len(result.Communities)
+        switch criterion {
+        case "modularity":
+            score.Score = Modularity(g, result.Communities)
+        case "coverage":
+            score.Score = Coverage(g, result.Communities)
+        case "count":
+            score.Score = float64(score.Communities)
+        }
+        scores = append(scores, score)
+        if score.Score > scores[best].Score {
+            best = len(scores) - 1
+        }
+    }
+    return scores[best].K, scores, nil
+}
+
+// FUNCTION: MembershipMap
+//
+// DESCRIPTION: Maps every vertex label that is covered by a community
+// to the ids of all the communities it belongs to. Overlapping
+// vertices map to more than one id, in ascending order.
+
+func MembershipMap(communities [][]*GraphNode) map[string][]int {
+    membership := make(map[string][]int)
+    for i, community := range communities {
+        for _, node := range community {
+            membership[node.label] = append(membership[node.label], i + 1)
+        }
+    }
+    return membership
+}
+
+// FUNCTION: MergeIsolated
+//
+// DESCRIPTION: Assigns every vertex of g that no community covers to
+// the community containing the most of its neighbors, with ties going
+// to the lowest community id. The choice is made from the original
+// communities, so the order of g doesn't matter. Returns the enlarged
+// communities and the vertices that have no neighbor in any
+// community and so stay uncovered. Virtual vertices are never
+// assigned. Community ids are unchanged.
+
+func MergeIsolated(g []*GraphNode, communities [][]*GraphNode) ([][]*GraphNode, []*GraphNode) {
+    membership := MembershipMap(communities)
+    merged := make([][]*GraphNode, len(communities))
+    for i, community := range communities {
+        merged[i] = append([]*GraphNode{}, community...)
+    }
+
+    var uncovered []*GraphNode
+    for _, node := range g {
+        if node.virtual || membership[node.label] != nil {
+            continue
+        }
+        counts := make(map[int]int)
+        for _, n := range node.neighbors {
+            for _, id := range membership[n.label] {
+                counts[id]++
+            }
+        }
+        best := 0
+        for id, count := range counts {
+            if count > counts[best] || (count == counts[best] && id < best) {
+                best = id
+            }
+        }
+        if best == 0 {
+            uncovered = append(uncovered, node)
+            continue
+        }
+        merged[best - 1] = append(merged[best - 1], node)
+    }
+    return merged, uncovered
+}
+
+// Bridge is a vertex shared by several communities. Pairs is the
+// number of community pairs it links.
+type Bridge struct {
+    Label string
+    Communities []int
+    Pairs int
+}
+
+// FUNCTION: Bridges
+//
+// DESCRIPTION: Returns every vertex that belongs to more than one
+// community, most bridging first (ties by label). A vertex in m
+// communities bridges m(m-1)/2 pairs of them. This is a cheap
+// stand-in for betweenness that comes straight from the overlap CPM
+// already found.
+
+func Bridges(result *CPMResult) []Bridge {
+    var bridges []Bridge
+    for label, ids := range result.Membership {
+        if len(ids) > 1 {
+            bridges = append(bridges, Bridge{label, ids, len(ids) * (len(ids) - 1) / 2})
+        }
+    }
+    sort.Slice(bridges, func(i, j int) bool {
+        if bridges[i].Pairs != bridges[j].Pairs {
+            return bridges[i].Pairs > bridges[j].Pairs
+        }
+        return bridges[i].Label < bridges[j].Label
+    })
+    return bridges
+}
+
+// FUNCTION: FprintMembership
+//
+// DESCRIPTION: Writes the vertex to community relation of result to w
+// in the graph definition file format, one line per vertex of the
+// graph in graph order with the ids of its communities on the rhs,
+// e.g. "v3: 1 2". Uncovered vertices have an empty rhs.
+
+func FprintMembership(w io.Writer, result *CPMResult) {
+    for _, node := range result.Graph {
+        if node.virtual {
+            continue
+        }
+        fmt.Fprintf(w, "%s:", node.label)
+        for _, id := range result.Membership[node.label] {
+            fmt.Fprintf(w, " %d", id)
+        }
+        fmt.Fprintf(w, "\n")
+    }
+}
+
+// FUNCTION: CommunitiesOf
+//
+// DESCRIPTION: Returns the ids of the communities that the vertex
+// named label belongs to. A vertex not covered by any community (or
+// not in the graph at all) returns an empty slice.
+
+func (result *CPMResult) CommunitiesOf(label string) []int {
+    ids := result.Membership[label]
+    if ids == nil {
+        return []int{}
+    }
+    return ids
+}
+
+// FUNCTION: FprintCliques
+//
+// DESCRIPTION: Writes the clique list to w, one clique per line: its
+// ID, a colon and the vertex labels separated by spaces, e.g.
+// "c261e602825a9: v1 v2 v3".
+
+func FprintCliques(w io.Writer, clique_list *Clique) {
+    for item := clique_list; item != nil; item = item.next {
+        fmt.Fprintf(w, "%s:", item.ID())
+        for _, node := range item.nodes {
+            fmt.Fprintf(w, " %s", node.label)
+        }
+        fmt.Fprintf(w, "\n")
+    }
+}
+
+// FUNCTION: FprintCommunities
+//
+// DESCRIPTION: Writes the communities to w as a numbered list of
+// original graph labels, e.g. "Community 1: v1 v2 v3".
+
+func FprintCommunities(w io.Writer, communities [][]*GraphNode) {
+    for i, community := range communities {
+        FprintCommunityLine(w, i + 1, community, false)
+    }
+}
+
+// COMMUNITY_COLORS is the ANSI foreground color palette FprintCommunityLine
+// cycles through.
+var COMMUNITY_COLORS = []string{"31", "32", "33", "34", "35", "36", "91", "92", "93", "94", "95", "96"}
+
+// FUNCTION: FprintCommunityLine
+//
+// DESCRIPTION: Writes community id to w as "Community 1: v1 v2 v3".
+// With color set the line is drawn in the community's ANSI color, so
+// a vertex in several communities shows up in several colors.
+
+func FprintCommunityLine(w io.Writer, id int, members []*GraphNode, color bool) {
+    if color {
+        fmt.Fprintf(w, "\x1b[%sm", COMMUNITY_COLORS[(id - 1) % len(COMMUNITY_COLORS)])
+    }
+    fmt.Fprintf(w, "Community %d:", id)
+    for _, node := range members {
+        fmt.Fprintf(w, " %s", node.label)
+    }
+    if color {
+        fmt.Fprintf(w, "\x1b[0m")
+    }
+    fmt.Fprintf(w, "\n")
+}
+
+// FUNCTION: IsTerminal
+//
+// DESCRIPTION: Reports whether file is a terminal (a character
+// device) rather than a pipe or a regular file.
+
+func IsTerminal(file *os.File) bool {
+    info, err := file.Stat()
+    return err == nil && info.Mode() & os.ModeCharDevice != 0
+}
+
+// FUNCTION: LargestCommunities
+//
+// DESCRIPTION: Returns the indexes of the n largest communities, by
+// number of vertices in descending order. Communities of the same
+// size keep their relative order. All of them are returned if there
+// are no more than n.
+
+func LargestCommunities(communities [][]*GraphNode, n int) []int {
+    var order []int
+    for i := range communities {
+        order = append(order, i)
+    }
+    sort.SliceStable(order, func(i, j int) bool {
+        return len(communities[order[i]]) > len(communities[order[j]])
+    })
+    if n < len(order) {
+        order = order[:n]
+    }
+    return order
+}
+
+// FUNCTION: SortGraph
+//
+// DESCRIPTION: Puts g into canonical order in place: vertices sorted
+// by label, and each neighbor list (with its weights) sorted by label.
+
+func SortGraph(g []*GraphNode) {
+    sort.SliceStable(g, func(i, j int) bool {
+        return g[i].label < g[j].label
+    })
+    for _, node := range g {
+        sort.Sort(byNeighborLabel{node})
+    }
+}
+
+// byNeighborLabel sorts a node's neighbors and weights together.
+type byNeighborLabel struct {
+    node *GraphNode
+}
+
+func (b byNeighborLabel) Len() int {
+    return len(b.node.neighbors)
+}
+
+func (b byNeighborLabel) Less(i, j int) bool {
+    return b.node.neighbors[i].label < b.node.neighbors[j].label
+}
+
+func (b byNeighborLabel) Swap(i, j int) {
+    b.node.neighbors[i], b.node.neighbors[j] = b.node.neighbors[j], b.node.neighbors[i]
+    b.node.weights[i], b.node.weights[j] = b.node.weights[j], b.node.weights[i]
+}
+
+// FUNCTION: SortNodes
+//
+// DESCRIPTION: Sorts nodes by label in place.
+
+func SortNodes(nodes []*GraphNode) {
+    sort.SliceStable(nodes, func(i, j int) bool {
+        return nodes[i].label < nodes[j].label
+    })
+}
+
+// FUNCTION: LessNodes
+//
+// DESCRIPTION: Orders two vertex lists lexicographically by label,
+// a shorter list coming first when it is a prefix of the other.
+
+func LessNodes(a []*GraphNode, b []*GraphNode) bool {
+    for i := 0; i < len(a) && i < len(b); i++ {
+        if a[i].label != b[i].label {
+            return a[i].label < b[i].label
+        }
+    }
+    return len(a) < len(b)
+}
+
+// FUNCTION: SortCliques
+//
+// DESCRIPTION: Puts clique_list into canonical order: the vertices of
+// each clique sorted by label, and the cliques sorted by LessNodes.
+// Community graph labels made from sorted cliques are canonical too.
+
+func SortCliques(clique_list *Clique) *Clique {
+    var cliques []*Clique
+    for item := clique_list; item != nil; item = item.next {
+        SortNodes(item.nodes)
+        cliques = append(cliques, item)
+    }
+    sort.SliceStable(cliques, func(i, j int) bool {
+        return LessNodes(cliques[i].nodes, cliques[j].nodes)
+    })
+    var head *Clique = nil
+    for i := len(cliques) - 1; i >= 0; i-- {
+        cliques[i].next = head
+        head = cliques[i]
+    }
+    return head
+}
+
+// FUNCTION: SortCommunities
+//
+// DESCRIPTION: Puts communities into canonical order in place: the
+// members of each community sorted by label, and the communities
+// sorted by LessNodes. Community ids follow this order, so they are
+// stable for a given graph. components, if not nil, is parallel to
+// communities (see CPMResult.Components) and is reordered with it.
+
+func SortCommunities(communities [][]*GraphNode, components []int) {
+    for _, community := range communities {
+        SortNodes(community)
+    }
+    order := make([]int, len(communities))
+    for i := range order {
+        order[i] = i
+    }
+    sort.SliceStable(order, func(i, j int) bool {
+        return LessNodes(communities[order[i]], communities[order[j]])
+    })
+    sorted := make([][]*GraphNode, len(communities))
+    for i, o := range order {
+        sorted[i] = communities[o]
+    }
+    copy(communities, sorted)
+    if components != nil {
+        sorted_components := make([]int, len(components))
+        for i, o := range order {
+            sorted_components[i] = components[o]
+        }
+        copy(components, sorted_components)
+    }
+}
+
+// FUNCTION: IndexOrder
+//
+// DESCRIPTION: Returns the vertices of g sorted by label. This is the
+// order in which vertices are numbered by IndexMap.
+
+func IndexOrder(g []*GraphNode) []*GraphNode {
+    order := make([]*GraphNode, len(g))
+    copy(order, g)
+    SortNodes(order)
+    return order
+}
+
+// FUNCTION: IndexMap
+//
+// DESCRIPTION: Numbers the vertices of g from 1 in label order, for
+// output formats and external tools that want integer vertex ids. The
+// numbering only depends on the labels, so it is stable across runs
+// and however the input is ordered.
+
+func IndexMap(g []*GraphNode) map[*GraphNode]int {
+    index := make(map[*GraphNode]int)
+    for i, node := range IndexOrder(g) {
+        index[node] = i + 1
+    }
+    return index
+}
+
+// FUNCTION: WriteIndexMap
+//
+// DESCRIPTION: Writes the IndexMap of g to w as `label<TAB>index`
+// lines in index order, so integer ids in results can be translated
+// back to labels.
+
+func WriteIndexMap(w io.Writer, g []*GraphNode) {
+    for i, node := range IndexOrder(g) {
+        fmt.Fprintf(w, "%s\t%d\n", node.label, i + 1)
+    }
+}
+
+// FUNCTION: WriteIndexMapFile
+//
+// DESCRIPTION: Same as WriteIndexMap, but writes to the file at path.
+
+func WriteIndexMapFile(path string, g []*GraphNode) error {
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    WriteIndexMap(file, g)
+    return file.Close()
+}
+
+// FUNCTION: WriteMatrixMarket
+//
+// DESCRIPTION: Writes the adjacency matrix of g to w in Matrix Market
+// coordinate format. Vertices are numbered by IndexMap, and each
+// neighbor list entry becomes one entry of the matrix whose value is
+// the edge weight (1.0 if unweighted). Since a graph definition file
+// can list an edge from one side only, the matrix is "general" rather
+// than "symmetric". The index to label mapping is also written as
+// comment lines between the header and the size line, e.g.
+//
+// %%MatrixMarket matrix coordinate real general
+// % 1 v1
+// % 2 v2
+// 2 2 2
+// 1 2 1
+// 2 1 1
+
+func WriteMatrixMarket(w io.Writer, g []*GraphNode) {
+    index := IndexMap(g)
+    order := IndexOrder(g)
+    entry_count := 0
+    for _, node := range g {
+        entry_count += len(node.neighbors)
+    }
+
+    fmt.Fprintf(w, "%%%%MatrixMarket matrix coordinate real general\n")
+    for i, node := range order {
+        fmt.Fprintf(w, "%% %d %s\n", i + 1, node.label)
+    }
+    fmt.Fprintf(w, "%d %d %d\n", len(g), len(g), entry_count)
+    for i, node := range order {
+        for j, n := range node.neighbors {
+            fmt.Fprintf(w, "%d %d %g\n", i + 1, index[n], node.weights[j])
+        }
+    }
+}
+
+// FUNCTION: NewOptions
+//
+// DESCRIPTION: Returns the default Options -- k=3, the candidate
+// generator, a checkpoint every 1000 nodes -- with the given options
+// applied in order. The fields that only affect how a result is
+// printed (ShowWeights, ASCII and so on) are set directly.
+
+func NewOptions(options ...Option) Options {
+    var opts Options
+    opts.K = 3
+    opts.Algo = "auto"
+    opts.CheckpointEvery = 1000
+    opts.Partitions = 2
+    for _, option := range options {
+        option(&opts)
+    }
+    return opts
+}
+
+// FUNCTION: WithK
+//
+// DESCRIPTION: Sets the clique size.
+
+func WithK(k int) Option {
+    return func(opts *Options) { opts.K = k }
+}
+
+// FUNCTION: WithMixedK
+//
+// DESCRIPTION: Percolates cliques of all the given sizes together.
+
+func WithMixedK(sizes ...int) Option {
+    return func(opts *Options) { opts.MixedK = sizes }
+}
+
+// FUNCTION: WithWeightThreshold
+//
+// DESCRIPTION: Turns on CPMw: only cliques whose intensity exceeds
+// threshold are used. A threshold of 0 turns it off.
+
+func WithWeightThreshold(threshold float64) Option {
+    return func(opts *Options) {
+        opts.Accept = nil
+        opts.WeightThreshold = threshold
+        if threshold > 0 {
+            opts.Accept = IntensityPredicate(threshold)
+        }
+    }
+}
+
+// FUNCTION: WithAccept
+//
+// DESCRIPTION: Sets an arbitrary clique filter.
+
+func WithAccept(accept CliqueAcceptFunc) Option {
+    return func(opts *Options) {
+        opts.Accept = accept
+        opts.WeightThreshold = 0
+    }
+}
+
+// FUNCTION: WithLimits
+//
+// DESCRIPTION: Bounds the clique search.
+
+func WithLimits(limits Limits) Option {
+    return func(opts *Options) { opts.Limits = limits }
+}
+
+// FUNCTION: WithAlgo
+//
+// DESCRIPTION: Selects the clique search, "auto" (the default; see
+// ChooseAlgo), "candidates" or "bk", or "gn" for the Girvan-Newman
+// baseline instead of CPM.
+
+func WithAlgo(algo string) Option {
+    return func(opts *Options) { opts.Algo = algo }
+}
+
+// FUNCTION: WithPartitions
+//
+// DESCRIPTION: Sets the number of communities for the "gn" algorithm.
+
+func WithPartitions(partitions int) Option {
+    return func(opts *Options) { opts.Partitions = partitions }
+}
+
+// FUNCTION: WithMergeThreshold
+//
+// DESCRIPTION: Merges communities whose Jaccard similarity exceeds
+// threshold.
+
+func WithMergeThreshold(threshold float64) Option {
+    return func(opts *Options) { opts.MergeThreshold = threshold }
+}
+
+// FUNCTION: WithDropContained
+//
+// DESCRIPTION: Drops cliques contained in larger cliques.
+
+func WithDropContained(drop bool) Option {
+    return func(opts *Options) { opts.DropContained = drop }
+}
+
+// FUNCTION: WithMinOverlap
+//
+// DESCRIPTION: Percolates cliques that share at least overlap
+// vertices, instead of k-1.
+
+func WithMinOverlap(overlap int) Option {
+    return func(opts *Options) { opts.MinOverlap = overlap }
+}
+
+// FUNCTION: WithMergeIsolated
+//
+// DESCRIPTION: Folds uncovered vertices into their neighbors'
+// community.
+
+func WithMergeIsolated(merge bool) Option {
+    return func(opts *Options) { opts.MergeIsolated = merge }
+}
+
+// FUNCTION: WithRepeatable
+//
+// DESCRIPTION: Puts the graph, cliques and communities in canonical
+// order.
+
+func WithRepeatable(repeatable bool) Option {
+    return func(opts *Options) { opts.Repeatable = repeatable }
+}
+
+// FUNCTION: WithJobs
+//
+// DESCRIPTION: Builds the community graph and extracts the
+// communities from its components with jobs goroutines (see
+// CreateCommunityGraphParallel and FindCommunitiesParallel).
+
+func WithJobs(jobs int) Option {
+    return func(opts *Options) { opts.Jobs = jobs }
+}
+
+// FUNCTION: WithCheckpoint
+//
+// DESCRIPTION: Saves the clique search state to path after every
+// every nodes.
+
+func WithCheckpoint(path string, every int) Option {
+    return func(opts *Options) {
+        opts.Checkpoint = path
+        opts.CheckpointEvery = every
+    }
+}
+
+// FUNCTION: WithResume
+//
+// DESCRIPTION: Resumes the clique search from the checkpoint file
+// path.
+
+func WithResume(path string) Option {
+    return func(opts *Options) { opts.Resume = path }
+}
+
+// FUNCTION: Run
+//
+// DESCRIPTION: Runs the whole CPM pipeline on g as described in the
+// theory of operation and returns every stage in a CPMResult. Run
+// doesn't print anything; callers decide how to present the result.
+// With opts.Repeatable the graph (sorted in place), the cliques and
+// the communities are all put in canonical label order, so the result
+// is identical however the input was ordered. With opts.Checkpoint the
+// state of the clique search is saved periodically, and opts.Resume
+// continues a search from such a checkpoint; it must be run on the
+// same graph with the same options. opts.Algo "auto", the default,
+// picks the clique search with ChooseAlgo and puts the cliques in
+// canonical order, so the result doesn't depend on which search was
+// picked. opts.Algo "bk" finds the cliques
+// with BronKerboschKCliques instead of the candidate generator; the
+// node and edge limits are checked up front whatever the algorithm,
+// but the clique, candidate and duration limits, checkpoints and node
+// timings only apply to the candidate generator. opts.MixedK finds the cliques of
+// each of its sizes and percolates them together with
+// CreateMixedCommunityGraph; result.K is then the smallest size.
+// opts.MinOverlap connects cliques sharing that many vertices instead
+// of k-1; it must be between 1 and k-1 and can't be combined with
+// opts.MixedK.
+// opts.Algo "gn" skips CPM altogether and partitions the graph into
+// opts.Partitions communities with GirvanNewman, as a baseline.
+// With opts.MergeIsolated the vertices no community covers are folded
+// in by MergeIsolated. A complete graph is recognized up front: its
+// one community is returned with a warning, without searching for its
+// exponentially many cliques, and result.CliquesSkipped is set.
+// If a limit is exceeded the result holds the cliques found so far
+// and the error wraps ErrLimitExceeded.
+
+func Run(g []*GraphNode, opts Options) (*CPMResult, error) {
+    result := new(CPMResult)
+    result.K = opts.K
+    result.Options = opts
+    result.Graph = g
+    var err error
+
+    sizes := []int{opts.K}
+    if len(opts.MixedK) > 0 {
+        sizes = opts.MixedK
+    }
+    // Percolation connects cliques sharing k-1 vertices; below k = 2
+    // that is no vertices at all, and every clique would join every
+    // other, so it is refused rather than give a meaningless answer.
+    for _, k := range sizes {
+        if opts.Algo != "gn" && k < 2 {
+            errstr := fmt.Sprintf("k=%d: cliques must have at least 2 vertices", k)
+            return result, errors.New(errstr)
+        }
+    }
+    // Two distinct k-cliques share at most k-1 vertices, so a larger
+    // overlap would find no percolation at all, and an overlap of 0
+    // would join every clique to every other.
+    if opts.MinOverlap != 0 && opts.Algo != "gn" {
+        if len(opts.MixedK) > 0 {
+            return result, errors.New("min-overlap can't be used with mixed k")
+        }
+        if opts.MinOverlap < 1 || opts.MinOverlap > opts.K - 1 {
+            errstr := fmt.Sprintf("min-overlap=%d: must be between 1 and k-1 = %d",
+                opts.MinOverlap, opts.K - 1)
+            return result, errors.New(errstr)
+        }
+    }
+    if len(opts.MixedK) > 0 {
+        if opts.Checkpoint != "" || opts.Resume != "" {
+            return result, errors.New("checkpoints can't be used with mixed k")
+        }
+        sizes = opts.MixedK
+        result.K = sizes[0]
+        for _, k := range sizes {
+            if k < result.K {
+                result.K = k
+            }
+        }
+    }
+
+    if err := CheckGraphLimits(g, opts.Limits); err != nil {
+        return result, err
+    }
+    if opts.Repeatable {
+        SortGraph(g)
+    }
+    if opts.Algo == "gn" {
+        result.Communities = GirvanNewman(g, opts.Partitions)
+        if opts.Repeatable {
+            SortCommunities(result.Communities, nil)
+        }
+        result.Membership = MembershipMap(result.Communities)
+        result.Stats.Nodes = len(g)
+        result.Stats.Edges = EdgeCount(g)
+        result.Stats.Communities = len(result.Communities)
+        return result, nil
+    }
+
+    // In a complete graph every k-subset is a k-clique, so the clique
+    // search would take exponential time to find the obvious: one
+    // community of every vertex. It is skipped; the cliques and the
+    // community graph are left empty and CliquesSkipped says why.
+    if opts.Accept == nil && len(opts.MixedK) == 0 && opts.Resume == "" &&
+        opts.K <= len(g) && IsComplete(g) {
+        result.Warnings = append(result.Warnings,
+            fmt.Sprintf("complete graph of %d vertices: clique search skipped", len(g)))
+        result.CliquesSkipped = true
+        community := append([]*GraphNode{}, g...)
+        if opts.Repeatable {
+            SortNodes(community)
+        }
+        result.Communities = [][]*GraphNode{community}
+        result.Membership = MembershipMap(result.Communities)
+        result.Stats.Nodes = len(g)
+        result.Stats.Edges = EdgeCount(g)
+        result.Stats.Cliques = Binomial(len(g), opts.K)
+        result.Stats.Communities = 1
+        return result, nil
+    }
+
+    accept := ExcludeVirtual(opts.Accept)
+    var search CliqueSearch
+    search.K = opts.K
+    search.Accept = accept
+    search.Limits = opts.Limits
+    if opts.Resume != "" {
+        next, resumed, err := ReadCheckpoint(opts.Resume, g, opts.K)
+        if err != nil {
+            return result, err
+        }
+        search.Start = next
+        search.Cliques = resumed
+    }
+    if opts.Checkpoint != "" {
+        search.CheckpointEvery = opts.CheckpointEvery
+        search.OnCheckpoint = func(next int, clique_list *Clique) error {
+            return WriteCheckpoint(opts.Checkpoint, g, opts.K, next, clique_list)
+        }
+    }
+    result.Algo = opts.Algo
+    if opts.Algo == "auto" {
+        result.Algo = ChooseAlgo(g, opts)
+    }
+    var clique_list *Clique
+    var tail *Clique
+    for _, k := range sizes {
+        var found *Clique
+        search.K = k
+        switch result.Algo {
+        case "", "candidates":
+            var timings []NodeTiming
+            found, timings, err = SearchKCliques(g, search)
+            result.NodeTimings = append(result.NodeTimings, timings...)
+        case "bk":
+            found = FilterCliques(BronKerboschKCliques(g, k), accept)
+        default:
+            errstr := fmt.Sprintf("%s: unknown clique algorithm", opts.Algo)
+            return result, errors.New(errstr)
+        }
+        if found != nil {
+            if tail == nil {
+                clique_list = found
+            } else {
+                tail.next = found
+            }
+            for tail = found; tail.next != nil; tail = tail.next {
+            }
+        }
+        result.Cliques = clique_list
+        if err != nil {
+            return result, err
+        }
+    }
+    if opts.DropContained {
+        clique_list = DropContainedCliques(clique_list)
+        result.Cliques = clique_list
+    }
+    // the two searches find the cliques in different orders, which
+    // would show in the community graph labels and community order
+    if opts.Repeatable || opts.Algo == "auto" {
+        clique_list = SortCliques(clique_list)
+        result.Cliques = clique_list
+    }
+    if len(opts.MixedK) > 0 {
+        result.CommunityGraph = CreateMixedCommunityGraph(clique_list)
+    } else {
+        // CreateCommunityGraph connects cliques sharing k-1 vertices,
+        // so an overlap of m is asked for as k = m+1
+        overlap_k := opts.K
+        if opts.MinOverlap > 0 {
+            overlap_k = opts.MinOverlap + 1
+        }
+        result.CommunityGraph = CreateCommunityGraphParallel(clique_list, overlap_k, opts.Jobs)
+    }
+    if err := CheckCommunityGraph(result.CommunityGraph); err != nil {
+        return result, err
+    }
+    result.Communities = FindCommunitiesParallel(result.CommunityGraph, opts.Jobs)
+    // FindCommunities returns the communities in component order
+    result.Components = make([]int, len(result.Communities))
+    for i := range result.Components {
+        result.Components[i] = i
+    }
+    if opts.MergeThreshold > 0 {
+        result.Communities, result.Components = MergeSimilarCommunities(
+            result.Communities, result.Components, opts.MergeThreshold)
+    }
+    if opts.Repeatable {
+        SortCommunities(result.Communities, result.Components)
+    }
+    if opts.MergeIsolated {
+        result.Communities, result.Uncovered = MergeIsolated(g, result.Communities)
+        if opts.Repeatable {
+            for _, community := range result.Communities {
+                SortNodes(community)
+            }
+        }
+    }
+    result.Membership = MembershipMap(result.Communities)
+
+    result.Stats.Nodes = len(g)
+    result.Stats.Edges = EdgeCount(g)
+    result.Stats.Cliques = CountCliques(clique_list)
+    result.Stats.Communities = len(result.Communities)
+    return result, nil
+}
+
+// Graph is a parsed graph together with the parser's warnings. With
+// ParseGraph it is the entry point for using CPM from other code:
+//
+//   g, err := ParseGraph(r)
+//   communities, err := g.Communities(3)
+//
+// None of its methods print anything.
+type Graph struct {
+    Nodes []*GraphNode
+    Warnings []string // see GraphWarnings
+}
+
+// FUNCTION: ParseGraph
+//
+// DESCRIPTION: Reads a graph in the graph definition file format
+// from r, a line at a time, with ParseGraphDefReader. A graph that fails
+// CheckNeighborCounts is an error. As with ParseGraphFile, self-loops
+// are dropped and edges listed by only one endpoint are made
+// undirected.
+
+func ParseGraph(r io.Reader) (*Graph, error) {
+    graph := new(Graph)
+    result, err := ParseGraphDefReader(r, ParseOptions{})
+    graph.Nodes = result.Graph
+    graph.Warnings = result.Warnings
+    if err != nil {
+        return graph, err
+    }
+    if err := CheckNeighborCounts(graph.Nodes); err != nil {
+        return graph, err
+    }
+    result.Warnings = append(result.Warnings, GraphWarnings(graph.Nodes)...)
+    NormalizeParsed(result, ParseOptions{})
+    graph.Warnings = result.Warnings
+    return graph, nil
+}
+
+// FUNCTION: Cliques
+//
+// DESCRIPTION: Returns the k-cliques of g, as found by FindKCliques.
+
+func (g *Graph) Cliques(k int) []*Clique {
+    var cliques []*Clique
+    for item := FindKCliques(g.Nodes, k); item != nil; item = item.next {
+        cliques = append(cliques, item)
+    }
+    return cliques
+}
+
+// FUNCTION: Communities
+//
+// DESCRIPTION: Runs CPM on g with clique size k and the default
+// options, and returns the labels of each community's vertices. See
+// Run for the errors.
+
+func (g *Graph) Communities(k int) ([][]string, error) {
+    result, err := Run(g.Nodes, NewOptions(WithK(k)))
+    if err != nil {
+        return nil, err
+    }
+    communities := [][]string{}
+    for _, community := range result.Communities {
+        communities = append(communities, NodeLabels(community))
+    }
+    return communities, nil
+}
+
+// FUNCTION: ChooseAlgo
+//
+// DESCRIPTION: Picks the clique search for Options.Algo "auto", the
+// default: the candidate generator takes time exponential in the
+// vertex degrees, so graphs denser than AUTO_BK_DENSITY get
+// Bron-Kerbosch ("bk") and the sparser ones "candidates". Only the
+// candidate generator honours the clique and duration limits and
+// checkpoints, so it is always chosen when opts asks for any of those.
+// Both find the same cliques.
+
+func ChooseAlgo(g []*GraphNode, opts Options) string {
+    if opts.Limits.MaxCliques > 0 || opts.Limits.MaxDuration > 0 ||
+        opts.Checkpoint != "" || opts.Resume != "" {
+        return "candidates"
+    }
+    if Density(g) > AUTO_BK_DENSITY {
+        return "bk"
+    }
+    return "candidates"
+}
+
+// FUNCTION: Fingerprint
+//
+// DESCRIPTION: Returns a SHA-256 hex digest of result that is the
+// same for every run with the same graph and options, whatever the
+// input order: it covers k and the canonical (sorted) sets of edges,
+// k-cliques and communities. Any change to the graph's edges changes
+// the fingerprint, even one that leaves the communities alone.
+
+func Fingerprint(result *CPMResult) string {
+    hash := sha256.New()
+    fmt.Fprintf(hash, "k %d\n", result.K)
+
+    var edges []string
+    for _, edge := range Edges(result.Graph) {
+        labels := []string{edge[0].label, edge[1].label}
+        sort.Strings(labels)
+        edges = append(edges, fmt.Sprintf("%s %s %g", labels[0], labels[1],
+            EdgeWeight(edge[0], edge[1])))
+    }
+    sort.Strings(edges)
+    for _, edge := range edges {
+        fmt.Fprintf(hash, "edge %s\n", edge)
+    }
+
+    for _, key := range CliqueKeys(result.Cliques) {
+        fmt.Fprintf(hash, "clique %s\n", key)
+    }
+
+    var communities []string
+    for _, community := range result.Communities {
+        var labels []string
+        for _, node := range community {
+            labels = append(labels, node.label)
+        }
+        sort.Strings(labels)
+        communities = append(communities, strings.Join(labels, " "))
+    }
+    sort.Strings(communities)
+    for _, community := range communities {
+        fmt.Fprintf(hash, "community %s\n", community)
+    }
+    return hex.EncodeToString(hash.Sum(nil))
+}
+
+// FUNCTION: BipartiteGraph
+//
+// DESCRIPTION: Builds the dual of the community list: a bipartite
+// graph with one node per covered vertex and one node per community,
+// named c1, c2, ..., and an edge from each vertex to every community
+// it belongs to. Vertex nodes come first, in the order they are first
+// seen in communities, followed by the community nodes.
+
+func BipartiteGraph(communities [][]*GraphNode) []*GraphNode {
+    var vertex_nodes []*GraphNode
+    var community_nodes []*GraphNode
+    vertex_copies := make(map[*GraphNode]*GraphNode)
+
+    for i, community := range communities {
+        community_node := NewGraphNode(fmt.Sprintf("c%d", i + 1), nil)
+        community_nodes = append(community_nodes, community_node)
+        for _, vertex := range community {
+            vertex_node, ok := vertex_copies[vertex]
+            if ok == false {
+                vertex_node = NewGraphNode(vertex.label, nil)
+                vertex_copies[vertex] = vertex_node
+                vertex_nodes = append(vertex_nodes, vertex_node)
+            }
+            AddEdge(vertex_node, community_node)
+        }
+    }
+    return append(vertex_nodes, community_nodes...)
+}
+
+// NDJSONRecord is one line of the ndjson output format. Type is
+// "meta" (only with Options.RecordOptions), "node", "clique",
+// "community" or "summary", and only the fields that apply to that
+// type are set.
+type NDJSONRecord struct {
+    Type string `json:"type"`
+    Label string `json:"label,omitempty"`           // node
+    Neighbors []string `json:"neighbors,omitempty"` // node
+    Communities []int `json:"communities,omitempty"` // node: ids of its communities
+    ID int `json:"id,omitempty"`                    // clique, community: 1-based
+    CliqueID string `json:"clique_id,omitempty"`    // clique: its stable Clique.ID
+    Nodes []string `json:"nodes,omitempty"`         // clique, community: member labels
+    K int `json:"k,omitempty"`                      // summary
+    Stats *Stats `json:"stats,omitempty"`          // summary
+    Options *OptionsRecord `json:"options,omitempty"` // meta
+}
+
+// FUNCTION: WriteNDJSON
+//
+// DESCRIPTION: Writes result to w as newline delimited JSON: one
+// NDJSONRecord per line for each vertex of the graph, then each
+// k-clique, then each community, and finally a summary record, so a
+// consumer can process the records one at a time.
+
+func WriteNDJSON(w io.Writer, result *CPMResult) error {
+    encoder := json.NewEncoder(w)
+    labels := func(nodes []*GraphNode) []string {
+        list := []string{}
+        for _, node := range nodes {
+            list = append(list, node.label)
+        }
+        return list
+    }
+
+    if result.Options.RecordOptions {
+        options := RecordOptions(result.Options)
+        if err := encoder.Encode(NDJSONRecord{Type: "meta", Options: &options}); err != nil {
+            return err
+        }
+    }
+    for _, node := range result.Graph {
+        record := NDJSONRecord{Type: "node", Label: node.label,
+            Neighbors: labels(node.neighbors),
+            Communities: result.Membership[node.label]}
+        if err := encoder.Encode(record); err != nil {
+            return err
+        }
+    }
+    id := 1
+    for item := result.Cliques; item != nil; item = item.next {
+        record := NDJSONRecord{Type: "clique", ID: id, CliqueID: item.ID(),
+            Nodes: labels(item.nodes)}
+        if err := encoder.Encode(record); err != nil {
+            return err
+        }
+        id++
+    }
+    for i, community := range result.Communities {
+        record := NDJSONRecord{Type: "community", ID: i + 1, Nodes: labels(community)}
+        if err := encoder.Encode(record); err != nil {
+            return err
+        }
+    }
+    stats := result.Stats
+    return encoder.Encode(NDJSONRecord{Type: "summary", K: result.K, Stats: &stats})
+}
+
+// FUNCTION: FprintCompact
+//
+// DESCRIPTION: Writes just the communities of result to w: a
+// "3 communities:" line, then one "Community 1: v1 v2 v3" line per
+// community with its members sorted by label. With
+// Options.TopCommunities set only that many of the largest are listed,
+// largest first, followed by how many were left out.
+
+func FprintCompact(w io.Writer, result *CPMResult) {
+    fmt.Fprintf(w, "%d communities:\n", len(result.Communities))
+    order := LargestCommunities(result.Communities, len(result.Communities))
+    if result.Options.TopCommunities > 0 {
+        order = LargestCommunities(result.Communities, result.Options.TopCommunities)
+    } else {
+        sort.Ints(order)
+    }
+    for _, i := range order {
+        members := append([]*GraphNode{}, result.Communities[i]...)
+        SortNodes(members)
+        FprintCommunityLine(w, i + 1, members, result.Options.Color)
+    }
+    if omitted := len(result.Communities) - len(order); omitted > 0 {
+        fmt.Fprintf(w, "(%d more communities omitted)\n", omitted)
+    }
+}
+
+// FUNCTION: WriteReport
+//
+// DESCRIPTION: Writes a human readable analysis of result to w, one
+// titled section each: the graph statistics, k and the cliques (with a
+// histogram of the maximal clique sizes), the communities with their
+// sizes and densities, the overlapping vertices, and the quality of
+// the partition by Modularity and Coverage.
+
+func WriteReport(w io.Writer, result *CPMResult) {
+    section := func(title string) {
+        fmt.Fprintf(w, "%s\n%s\n", title, strings.Repeat("-", len(title)))
+    }
+    g := result.Graph
+
+    section("Graph")
+    triangles, _, transitivity := Transitivity(g)
+    fmt.Fprintf(w, "vertices:     %d\n", len(g))
+    fmt.Fprintf(w, "edges:        %d\n", EdgeCount(g))
+    fmt.Fprintf(w, "density:      %.4f\n", Density(g))
+    fmt.Fprintf(w, "triangles:    %d\n", triangles)
+    fmt.Fprintf(w, "transitivity: %.4f\n", transitivity)
+
+    fmt.Fprintf(w, "\n")
+    section("Cliques")
+    fmt.Fprintf(w, "k:            %d\n", result.K)
+    fmt.Fprintf(w, "k-cliques:    %d\n", result.Stats.Cliques)
+    sizes := make(map[int]int)
+    largest := 0
+    for _, maximal := range MaximalCliques(g) {
+        sizes[len(maximal)]++
+        if len(maximal) > largest {
+            largest = len(maximal)
+        }
+    }
+    fmt.Fprintf(w, "maximal cliques by size:\n")
+    for size := 1; size <= largest; size++ {
+        if sizes[size] > 0 {
+            fmt.Fprintf(w, "  %3d: %d\n", size, sizes[size])
+        }
+    }
+
+    fmt.Fprintf(w, "\n")
+    section("Communities")
+    fmt.Fprintf(w, "%d communities\n", len(result.Communities))
+    for i, community := range result.Communities {
+        fmt.Fprintf(w, "Community %d: %d vertices, density %.4f:", i + 1,
+            len(community), CommunityDensity(g, community))
+        for _, node := range community {
+            fmt.Fprintf(w, " %s", node.label)
+        }
+        fmt.Fprintf(w, "\n")
+    }
+
+    fmt.Fprintf(w, "\n")
+    section("Overlap")
+    overlapping := 0
+    for _, node := range g {
+        if ids := result.Membership[node.label]; len(ids) > 1 {
+            overlapping++
+            fmt.Fprintf(w, "%s: in %d communities\n", node.label, len(ids))
+        }
+    }
+    fmt.Fprintf(w, "%d overlapping vertices, %d uncovered\n", overlapping,
+        len(UncoveredVertices(result)))
+
+    fmt.Fprintf(w, "\n")
+    section("Quality")
+    fmt.Fprintf(w, "modularity:   %.4f\n", Modularity(g, result.Communities))
+    fmt.Fprintf(w, "coverage:     %.4f\n", Coverage(g, result.Communities))
+}
+
+// FUNCTION: MarkdownEscape
+//
+// DESCRIPTION: Escapes text for a cell of a Markdown table: pipes,
+// which would end the cell, and backslashes get a backslash.
+
+func MarkdownEscape(text string) string {
+    text = strings.ReplaceAll(text, "\\", "\\\\")
+    return strings.ReplaceAll(text, "|", "\\|")
+}
+
+// FUNCTION: WriteMarkdown
+//
+// DESCRIPTION: Writes result to w as GitHub flavored Markdown tables
+// for pasting into reports: a summary of the counts, the communities
+// with their sizes and members, and the overlapping vertices -- those
+// in more than one community -- with the ids of their communities.
+
+func WriteMarkdown(w io.Writer, result *CPMResult) {
+    fmt.Fprintf(w, "## Summary\n\n")
+    fmt.Fprintf(w, "| k | vertices | edges | cliques | communities |\n")
+    fmt.Fprintf(w, "|---|---|---|---|---|\n")
+    fmt.Fprintf(w, "| %d | %d | %d | %d | %d |\n", result.K, result.Stats.Nodes,
+        result.Stats.Edges, result.Stats.Cliques, result.Stats.Communities)
+
+    fmt.Fprintf(w, "\n## Communities\n\n")
+    fmt.Fprintf(w, "| community | size | members |\n")
+    fmt.Fprintf(w, "|---|---|---|\n")
+    for i, community := range result.Communities {
+        var labels []string
+        for _, node := range community {
+            labels = append(labels, MarkdownEscape(node.label))
+        }
+        fmt.Fprintf(w, "| %d | %d | %s |\n", i + 1, len(community),
+            strings.Join(labels, " "))
+    }
+
+    fmt.Fprintf(w, "\n## Overlapping vertices\n\n")
+    fmt.Fprintf(w, "| vertex | communities |\n")
+    fmt.Fprintf(w, "|---|---|\n")
+    for _, node := range result.Graph {
+        ids := result.Membership[node.label]
+        if len(ids) < 2 {
+            continue
+        }
+        var list []string
+        for _, id := range ids {
+            list = append(list, strconv.Itoa(id))
+        }
+        fmt.Fprintf(w, "| %s | %s |\n", MarkdownEscape(node.label), strings.Join(list, " "))
+    }
+}
+
+// FUNCTION: WriteOneHot
+//
+// DESCRIPTION: Writes the membership of result to w as a CSV one-hot
+// matrix: a header row of "label" and the community ids, then one row
+// per vertex in graph order with its label and a 1 in the column of
+// every community it belongs to, 0 elsewhere. An overlapping vertex
+// has several 1s. Virtual vertices are left out.
+
+func WriteOneHot(w io.Writer, result *CPMResult) error {
+    writer := csv.NewWriter(w)
+    header := []string{"label"}
+    for i := range result.Communities {
+        header = append(header, strconv.Itoa(i + 1))
+    }
+    if err := writer.Write(header); err != nil {
+        return err
+    }
+    for _, node := range result.Graph {
+        if node.virtual {
+            continue
+        }
+        row := []string{node.label}
+        for range result.Communities {
+            row = append(row, "0")
+        }
+        for _, id := range result.Membership[node.label] {
+            row[id] = "1"
+        }
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+    writer.Flush()
+    return writer.Error()
+}
+
+// FUNCTION: WriteNMICommunities
+//
+// DESCRIPTION: Writes the communities of result to w in the layout
+// read by the overlapping NMI evaluation tools: one line per community
+// listing the IndexMap ids of its vertices, ascending and separated by
+// spaces. Labels don't appear, so the index map (see WriteIndexMap) is
+// needed to translate the ids back.
+
+func WriteNMICommunities(w io.Writer, result *CPMResult) {
+    index := IndexMap(result.Graph)
+    for _, community := range result.Communities {
+        var ids []int
+        for _, node := range community {
+            ids = append(ids, index[node])
+        }
+        sort.Ints(ids)
+        for i, id := range ids {
+            if i > 0 {
+                fmt.Fprintf(w, " ")
+            }
+            fmt.Fprintf(w, "%d", id)
+        }
+        fmt.Fprintf(w, "\n")
+    }
+}
+
+// FUNCTION: WriteResult
+//
+// DESCRIPTION: Writes result to w in the output format
+// named by outformat:
+//
+// text      -- k, the original graph, the community graph and the
+//              numbered communities, or with
+//              Options.Compact just the communities (see FprintCompact)
+// bipartite -- the vertex to community graph built by BipartiteGraph,
+//              in the graph definition file format
+// mtx       -- the adjacency matrix of the original graph in Matrix
+//              Market format (see WriteMatrixMarket)
+// membership -- a `v1: 1 2` line per vertex listing the ids of its
+//              communities (see FprintMembership)
+// ndjson    -- one JSON record per line for every vertex, clique and
+//              community, then a summary (see WriteNDJSON)
+// nmi       -- one line of integer vertex ids per community, for NMI
+//              evaluation tools (see WriteNMICommunities)
+// onehot    -- a CSV vertex by community 0/1 matrix (see WriteOneHot)
+// md        -- Markdown tables of the summary, communities and overlaps
+//              (see WriteMarkdown)
+// dot       -- the community graph as Graphviz DOT, a cluster per
+//              component (see WriteCommunityGraphDOT)
+// json      -- every stage of the pipeline as one JSON document (see
+//              WriteResultJSON)
+
+func WriteResult(w io.Writer, outformat string, result *CPMResult) error {
+
+    switch outformat {
+    case "text":
+        if result.Options.RecordOptions {
+            fmt.Fprintf(w, "# options: %s\n", OptionsComment(result.Options))
+        }
+        if result.Options.Compact {
+            FprintCompact(w, result)
+            return nil
+        }
+        fmt.Fprintf(w, "k= %d\n", result.K)
+        fmt.Fprintf(w, "The original graph\n")
+        fmt.Fprintf(w, "------------------\n")
+        FprintWeightedGraph(w, result.Graph, result.Options.ShowWeights)
+        fmt.Fprintf(w, "\n")
+        // Girvan-Newman has no community graph
+        if result.Options.Algo != "gn" {
+            fmt.Fprintf(w, "Community graph:\n")
+            fmt.Fprintf(w, "----------------\n")
+            if result.CliquesSkipped {
+                fmt.Fprintf(w, "(not built: the clique search was skipped for a complete graph)\n")
+            } else if result.Options.ASCII {
+                FprintASCIIGraph(w, result.CommunityGraph)
+            } else {
+                FprintGraph(w, result.CommunityGraph)
+            }
+            fmt.Fprintf(w, "\n")
+        }
+        fmt.Fprintf(w, "Communities:\n")
+        fmt.Fprintf(w, "------------\n")
+        for i, community := range result.Communities {
+            FprintCommunityLine(w, i + 1, community, result.Options.Color)
+        }
+        if result.Options.ShowVertexWeight {
+            fmt.Fprintf(w, "\n")
+            fmt.Fprintf(w, "Community vertex weights:\n")
+            fmt.Fprintf(w, "-------------------------\n")
+            for i, community := range result.Communities {
+                fmt.Fprintf(w, "Community %d: %g\n", i + 1, VertexWeight(community))
+            }
+        }
+        if result.Options.ShowConductance {
+            fmt.Fprintf(w, "\n")
+            fmt.Fprintf(w, "Community conductance:\n")
+            fmt.Fprintf(w, "----------------------\n")
+            for i, community := range result.Communities {
+                fmt.Fprintf(w, "Community %d: %.4f\n", i + 1,
+                    Conductance(result.Graph, community))
+            }
+        }
+        if result.Options.ShowDensity {
+            fmt.Fprintf(w, "\n")
+            fmt.Fprintf(w, "Community density:\n")
+            fmt.Fprintf(w, "------------------\n")
+            for i, community := range result.Communities {
+                fmt.Fprintf(w, "Community %d: %.4f\n", i + 1,
+                    CommunityDensity(result.Graph, community))
+            }
+        }
+        if result.Options.MergeIsolated && len(result.Uncovered) > 0 {
+            fmt.Fprintf(w, "\n")
+            fmt.Fprintf(w, "Uncovered vertices:")
+            for _, node := range result.Uncovered {
+                fmt.Fprintf(w, " %s", node.label)
+            }
+            fmt.Fprintf(w, "\n")
+        }
+        if result.Options.TopCommunities > 0 {
+            fmt.Fprintf(w, "\n")
+            fmt.Fprintf(w, "Largest communities:\n")
+            fmt.Fprintf(w, "--------------------\n")
+            top := LargestCommunities(result.Communities, result.Options.TopCommunities)
+            for _, i := range top {
+                FprintCommunityLine(w, i + 1, result.Communities[i], result.Options.Color)
+            }
+            if omitted := len(result.Communities) - len(top); omitted > 0 {
+                fmt.Fprintf(w, "(%d more communities omitted)\n", omitted)
+            }
+        }
+    case "bipartite":
+        FprintGraph(w, BipartiteGraph(result.Communities))
+    case "mtx":
+        WriteMatrixMarket(w, result.Graph)
+    case "membership":
+        FprintMembership(w, result)
+    case "ndjson":
+        return WriteNDJSON(w, result)
+    case "nmi":
+        WriteNMICommunities(w, result)
+    case "onehot":
+        return WriteOneHot(w, result)
+    case "md":
+        WriteMarkdown(w, result)
+    case "dot":
+        if result.Options.Algo == "gn" {
+            return errors.New("dot: Girvan-Newman has no community graph")
+        }
+        if result.CliquesSkipped {
+            return errors.New("dot: the clique search was skipped for a complete graph, so there is no community graph")
+        }
+        if result.Options.RecordOptions {
+            fmt.Fprintf(w, "// options: %s\n", OptionsComment(result.Options))
+        }
+        WriteCommunityGraphDOT(w, result.CommunityGraph)
+    case "json":
+        return WriteResultJSON(w, result)
+    default:
+        errstr := fmt.Sprintf("%s: unknown output format", outformat)
+        return errors.New(errstr)
+    }
+    return nil
+}
+
+// FUNCTION: DOTQuote
+//
+// DESCRIPTION: Returns label as a quoted DOT identifier. Quoting is
+// required for labels such as the comma separated community graph
+// labels made by CreateLabel.
+
+func DOTQuote(label string) string {
+    label = strings.Replace(label, `\`, `\\`, -1)
+    label = strings.Replace(label, `"`, `\"`, -1)
+    return `"` + label + `"`
+}
+
+// FUNCTION: WriteDOT
+//
+// DESCRIPTION: Writes g to w as an undirected Graphviz DOT graph. Every
+// vertex gets a node statement (so isolated vertices are drawn) and
+// every edge is written once, however many of its endpoints list it.
+
+func WriteDOT(w io.Writer, g []*GraphNode) {
+    WriteHighlightedDOT(w, g, nil)
+}
+
+// HIGHLIGHT_DOT_ATTRS are the DOT attributes of a highlighted vertex.
+const HIGHLIGHT_DOT_ATTRS = `style=filled, fillcolor=gold, shape=doublecircle`
+
+// FUNCTION: WriteHighlightedDOT
+//
+// DESCRIPTION: Same as WriteDOT, but the vertices whose labels are in
+// highlight are drawn with HIGHLIGHT_DOT_ATTRS so that they stand out,
+// e.g. the seed vertices of an analysis. Other vertices keep the
+// default style.
+
+func WriteHighlightedDOT(w io.Writer, g []*GraphNode, highlight map[string]bool) {
+    fmt.Fprintf(w, "graph {\n")
+    for _, node := range g {
+        if highlight[node.label] {
+            fmt.Fprintf(w, "    %s [%s];\n", DOTQuote(node.label), HIGHLIGHT_DOT_ATTRS)
+        } else {
+            fmt.Fprintf(w, "    %s;\n", DOTQuote(node.label))
+        }
+    }
+    for _, edge := range Edges(g) {
+        fmt.Fprintf(w, "    %s -- %s;\n", DOTQuote(edge[0].label),
+            DOTQuote(edge[1].label))
+    }
+    fmt.Fprintf(w, "}\n")
+}
+
+// DOT_COMPONENT_COLORS are the fill colors WriteCommunityGraphDOT gives
+// the components of the community graph, in turn.
+var DOT_COMPONENT_COLORS = []string{"lightblue", "palegreen", "lightpink", "khaki",
+    "plum", "lightsalmon", "paleturquoise", "wheat"}
+
+// FUNCTION: WriteCommunityGraphDOT
+//
+// DESCRIPTION: Writes the community graph to w as an undirected
+// Graphviz DOT graph in which each connected component -- each
+// community, before any merging -- is a cluster of its own, filled
+// with the next of DOT_COMPONENT_COLORS. The clique nodes keep their
+// comma separated labels, quoted by DOTQuote.
+
+func WriteCommunityGraphDOT(w io.Writer, community_graph []*GraphNode) {
+    fmt.Fprintf(w, "graph {\n")
+    for i, component := range ConnectedComponents(community_graph) {
+        fmt.Fprintf(w, "    subgraph cluster_%d {\n", i + 1)
+        fmt.Fprintf(w, "        label=\"%d\";\n", i + 1)
+        fmt.Fprintf(w, "        node [style=filled, fillcolor=%s];\n",
+            DOT_COMPONENT_COLORS[i % len(DOT_COMPONENT_COLORS)])
+        for _, node := range component {
+            fmt.Fprintf(w, "        %s;\n", DOTQuote(node.label))
+        }
+        fmt.Fprintf(w, "    }\n")
+    }
+    for _, edge := range Edges(community_graph) {
+        fmt.Fprintf(w, "    %s -- %s;\n", DOTQuote(edge[0].label),
+            DOTQuote(edge[1].label))
+    }
+    fmt.Fprintf(w, "}\n")
+}
+
+// FUNCTION: WriteCommunityDOTFiles
+//
+// DESCRIPTION: Writes one DOT file per community to dir, named
+// community-<id>.dot, holding the subgraph of the original graph
+// induced by the community's vertices. The vertices named in
+// result.Options.Highlight are highlighted. dir is created if it does
+// not exist.
+
+func WriteCommunityDOTFiles(dir string, result *CPMResult) error {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return err
+    }
+    highlight := make(map[string]bool)
+    for _, label := range result.Options.Highlight {
+        highlight[label] = true
+    }
+    for i, community := range result.Communities {
+        path := filepath.Join(dir, fmt.Sprintf("community-%d.dot", i + 1))
+        file, err := os.Create(path)
+        if err != nil {
+            return err
+        }
+        if result.Options.RecordOptions {
+            fmt.Fprintf(file, "// options: %s\n", OptionsComment(result.Options))
+        }
+        WriteHighlightedDOT(file, InducedSubgraph(community), highlight)
+        if err := file.Close(); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// FUNCTION: DumpIntermediate
+//
+// DESCRIPTION: Writes every artifact of the CPM pipeline to its own
+// file in dir so each stage can be inspected: the parsed graph
+// (graph.txt), the k-cliques (cliques.txt), the community graph
+// (community_graph.txt) and the final communities
+// (communities.txt). dir is created if it does not exist. When the
+// clique search was skipped, cliques.txt and community_graph.txt only
+// hold a comment saying so.
+
+func DumpIntermediate(dir string, result *CPMResult) error {
+
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return err
+    }
+
+    artifacts := []struct {
+        filename string
+        write func(w io.Writer)
+    }{
+        {"graph.txt", func(w io.Writer) { FprintGraph(w, result.Graph) }},
+        {"cliques.txt", func(w io.Writer) { FprintCliques(w, result.Cliques) }},
+        {"community_graph.txt", func(w io.Writer) { FprintGraph(w, result.CommunityGraph) }},
+        {"communities.txt", func(w io.Writer) { FprintCommunities(w, result.Communities) }},
+    }
+
+    for _, artifact := range artifacts {
+        path := filepath.Join(dir, artifact.filename)
+        file, err := os.Create(path)
+        if err != nil {
+            return err
+        }
+        skipped := artifact.filename == "cliques.txt" || artifact.filename == "community_graph.txt"
+        if result.CliquesSkipped && skipped {
+            fmt.Fprintf(file, "# clique search skipped: complete graph of %d vertices\n",
+                len(result.Graph))
+        } else {
+            artifact.write(file)
+        }
+        if err := file.Close(); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// FUNCTION: WriteSQL
+//
+// DESCRIPTION: Writes the graph, the k-cliques and the community
+// membership of result to db as four tables -- nodes, edges, cliques and
+// communities -- so the results can be queried with SQL. The tables
+// are created if absent, and any rows left in them by an earlier run
+// are deleted, in the same single transaction that inserts the new
+// rows, so the database always holds exactly one result. Cliques and
+// communities are numbered from 1 and have one row per member vertex.
+
+func WriteSQL(db *sql.DB, result *CPMResult) error {
+
+    schema := []string{
+        "CREATE TABLE IF NOT EXISTS nodes (label TEXT PRIMARY KEY)",
+        "CREATE TABLE IF NOT EXISTS edges (source TEXT, target TEXT)",
+        "CREATE TABLE IF NOT EXISTS cliques (clique_id INTEGER, label TEXT)",
+        "CREATE TABLE IF NOT EXISTS communities (community_id INTEGER, label TEXT)",
+    }
+    for _, statement := range schema {
+        if _, err := db.Exec(statement); err != nil {
+            return err
+        }
+    }
+
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    insert := func(query string, args ...interface{}) {
+        if err == nil {
+            _, err = tx.Exec(query, args...)
+        }
+    }
+    for _, table := range []string{"nodes", "edges", "cliques", "communities"} {
+        insert("DELETE FROM " + table)
+    }
+    for _, node := range result.Graph {
+        insert("INSERT INTO nodes (label) VALUES (?)", node.label)
+    }
+    for _, edge := range Edges(result.Graph) {
+        insert("INSERT INTO edges (source, target) VALUES (?, ?)",
+            edge[0].label, edge[1].label)
+    }
+    clique_id := 1
+    for item := result.Cliques; item != nil; item = item.next {
+        for _, node := range item.nodes {
+            insert("INSERT INTO cliques (clique_id, label) VALUES (?, ?)",
+                clique_id, node.label)
+        }
+        clique_id++
+    }
+    for i, community := range result.Communities {
+        for _, node := range community {
+            insert("INSERT INTO communities (community_id, label) VALUES (?, ?)",
+                i + 1, node.label)
+        }
+    }
+    if err != nil {
+        tx.Rollback()
+        return err
+    }
+    return tx.Commit()
+}
+
+// FUNCTION: WriteSQLiteFile
+//
+// DESCRIPTION: Opens (or creates) the SQLite database at path and
+// writes result to it with WriteSQL. This needs a database/sql driver
+// registered as "sqlite", which the package leaves to the program so
+// that callers who don't write SQLite don't link one: cmd/cpm links
+// the pure Go modernc.org/sqlite.
+
+func WriteSQLiteFile(path string, result *CPMResult) error {
+
+    registered := false
+    for _, driver := range sql.Drivers() {
+        if driver == "sqlite" {
+            registered = true
+        }
+    }
+    if registered == false {
+        return errors.New("sqlite: no sqlite database driver is linked into this build")
+    }
+
+    db, err := sql.Open("sqlite", path)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+    return WriteSQL(db, result)
+}
+
+// FUNCTION: Intern
+//
+// DESCRIPTION: Returns the copy of s recorded in table, recording s
+// first if it isn't there yet. Parsers use it so that every
+// occurrence of a label in a large file shares one backing string
+// rather than holding its own copy.
+
+func Intern(table map[string]string, s string) string {
+    if interned, ok := table[s]; ok {
+        return interned
+    }
+    table[s] = s
+    return s
+}
+
+// FUNCTION: parseVertexWeight
+//
+// DESCRIPTION: Sets the vertex weight of node from line[start:end],
+// the text between the brackets of a `v1[3.0]:` definition. A start
+// of -1 means the definition has no weight and node keeps the
+// default.
+
+func parseVertexWeight(node *GraphNode, line []byte, start int, end int,
+    line_count int) error {
+
+    if start < 0 {
+        return nil
+    }
+    weight, err := strconv.ParseFloat(strings.TrimSpace(string(line[start:end])), 64)
+    if err != nil {
+        errstr := fmt.Sprintf("line %d: '%s': invalid vertex weight",
+            line_count, string(line[start:end]))
+        return errors.New(errstr)
+    }
+    node.vertex_weight = weight
+    return nil
+}
+
+// Vertex labels are made of Unicode letters, marks, digits and
+// underscores. (Go's \w only matches ASCII word characters.) Labels
+// are compared and sorted byte for byte, with no Unicode
+// normalization, so graph files are assumed to be NFC normalized: a
+// precomposed "é" and an "e" followed by a combining accent are
+// different labels.
+const LABEL_RE = `[\p{L}\p{M}\p{N}_]+`
+
+var node_def_re = regexp.MustCompile(`\s*(` + LABEL_RE + `)(?:\[([^\]]*)\])?:\s*(.+)`)
+var node_no_neighbors_re = regexp.MustCompile(`\s*(` + LABEL_RE + `)(?:\[([^\]]*)\])?:\s*`)
+
+// FUNCTION: ParseNodeDefinition
+//
+// DESCRIPTION: Parses one line of a graph definition file. It returns
+// a new node for the vertex defined on the lhs of the colon and the
+// rhs neighbor string, which is empty if the vertex has no
+// neighbors. labels is the intern table for vertex labels.
+//
+// A '#' starts a comment that runs to the end of the line, e.g.
+// 'v1: v2 v3 # core triangle'. '#' can't appear in a label, so it
+// never needs escaping. A line that is empty or only a comment defines
+// no vertex and the returned node is nil.
+
+func ParseNodeDefinition(line []byte, line_count int,
+    labels map[string]string) (*GraphNode, string, error) {
+
+    if i := strings.IndexByte(string(line), '#'); i >= 0 {
+        line = []byte(strings.TrimRightFunc(string(line[:i]), unicode.IsSpace))
+    }
+    if strings.TrimSpace(string(line)) == "" {
+        return nil, "", nil
+    }
+
+    slices := node_def_re.FindStringSubmatchIndex(string(line))
+    if slices != nil {
+        start := slices[2]
+        end := slices[3]
+        add_node_label := line[start:end]
+        new_node := NewGraphNode(Intern(labels, string(add_node_label)), nil)
+        err := parseVertexWeight(new_node, line, slices[4], slices[5], line_count)
+        if err != nil {
+            return nil, "", err
+        }
+        start = slices[6]
+        end = slices[7]
+        neighbors_str := string(line[start:end])
+        // The following code determines if there are just spaces in the
+        // neighbor definition string. For example, a node definition of
+        // 'v1: ' is fine, but we need to account for the space because
+        // the regular expression node_def_re has matched the line but
+        // there are no neighbors.
+        neighbors_defined := false
+        for _, c := range neighbors_str {
+            if unicode.IsSpace(c) == false {
+                neighbors_defined = true
+                break
+            }
+        }
+        if neighbors_defined == false {
+            neighbors_str = ""
+        }
+        return new_node, neighbors_str, nil
+    }
+
+    slices = node_no_neighbors_re.FindStringSubmatchIndex(string(line))
+    if slices == nil {
+        errstr := fmt.Sprintf("line %d: syntax error\n", line_count)
+        return nil, "", errors.New(errstr)
+    }
+    start := slices[2]
+    end := slices[3]
+    add_node_label := line[start:end]
+    new_node := NewGraphNode(Intern(labels, string(add_node_label)), nil)
+    err := parseVertexWeight(new_node, line, slices[4], slices[5], line_count)
+    if err != nil {
+        return nil, "", err
+    }
+    return new_node, "", nil
+}
+
+// FUNCTION: DefineNode
+//
+// DESCRIPTION: Records new_node, parsed from line line_count, in
+// index and returns the node its neighbors should be added to, and
+// whether it is a vertex not seen before. A vertex defined a second
+// time is an error unless popts.MergeDuplicates is set, in which case
+// the earlier node is returned so that both neighbor lists end up on
+// it; the definitions must then agree on the vertex weight.
+
+func DefineNode(index map[string]*GraphNode, new_node *GraphNode, line_count int,
+    popts ParseOptions) (*GraphNode, bool, error) {
+
+    node, ok := index[new_node.label]
+    if ok == false {
+        index[new_node.label] = new_node
+        return new_node, true, nil
+    }
+    if popts.MergeDuplicates == false {
+        errstr := fmt.Sprintf("line %d: duplicate node '%s'", line_count, new_node.label)
+        return nil, false, errors.New(errstr)
+    }
+    if node.vertex_weight != new_node.vertex_weight {
+        errstr := fmt.Sprintf("line %d: '%s' redefined with a different vertex weight",
+            line_count, new_node.label)
+        return nil, false, errors.New(errstr)
+    }
+    return node, false, nil
+}
+
+// FUNCTION: ResolveNeighbors
+//
+// DESCRIPTION: Adds an edge from node to every vertex named in
+// neighbors_str, the rhs of its definition. The labels may be
+// separated by any run of spaces and tabs. lookup finds a vertex of
+// the graph by label and returns nil if there is none, which is an
+// error.
+
+func ResolveNeighbors(node *GraphNode, neighbors_str string,
+    lookup func(label string) *GraphNode, labels map[string]string) error {
+
+    neighbors := strings.Fields(neighbors_str)
+    for _, neighbor_label := range neighbors {
+        neighbor_label = Intern(labels, neighbor_label)
+        nn := lookup(neighbor_label)
+        if nn == nil {
+            errstr := fmt.Sprintf( "%s: doesn't exist", neighbor_label)
+            return errors.New(errstr)
+        } else {
+            AddNeighbor(node, nn)
+        }
+    }
+    return nil
+}
+
+// FUNCTION: ParseGraphDefFile
+//
+// DESCRIPTION: Given the filename of a graph definition file, this routine
+// parses the file and returns the graph if no syntax or semantic errors are
+// detected. If no errors are detected, then error returns as nil. Otherwise,
+// error will contain specific description of the problem. Defining a
+// vertex twice is an error. A filename of "-" reads standard input.
+// Either way the graph is parsed by ParseGraph.
+
+func ParseGraphDefFile(filename string) (g []*GraphNode, error error) {
+    file := os.Stdin
+    if filename != "-" {
+        opened, err := os.Open(filename)
+        if err != nil {
+            return nil, err
+        }
+        defer opened.Close()
+        file = opened
+    }
+    graph, err := ParseGraph(file)
+    return graph.Nodes, err
+}
+
+// FUNCTION: ReadFullLine
+//
+// DESCRIPTION: Reads the next line from reader, without its line
+// ending, however long it is. bufio.Reader.ReadLine returns a line
+// longer than the reader's buffer (MAX_LINE_LEN for the graph
+// definition parsers) in several fragments; they are joined here so
+// no part of a long neighbor list is lost.
+
+func ReadFullLine(reader *bufio.Reader) ([]byte, error) {
+    line, is_prefix, err := reader.ReadLine()
+    if err != nil || is_prefix == false {
+        return line, err
+    }
+    full := append([]byte{}, line...)
+    for is_prefix {
+        line, is_prefix, err = reader.ReadLine()
+        if err != nil {
+            return full, err
+        }
+        full = append(full, line...)
+    }
+    return full, nil
+}
+
+// FUNCTION: ParseGraphDefResult
+//
+// DESCRIPTION: Same as ParseGraphDefFile, but also returns the
+// parser's warnings, and repeated definitions of a vertex are merged
+// if popts says so (see DefineNode). The file is parsed by
+// ParseGraphDefReader.
+
+func ParseGraphDefResult(filename string, popts ParseOptions) (*ParseResult, error) {
+    file, err := os.Open(filename)
+    if err != nil {
+        return new(ParseResult), err
+    }
+    defer file.Close()
+    return ParseGraphDefReader(file, popts)
+}
+
+// FUNCTION: ParseGraphDefReader
+//
+// DESCRIPTION: The colon format parser. It reads r once, line by line,
+// creating a node for each definition and keeping its neighbor list
+// until every vertex is known, then resolves the neighbors. Files and
+// standard input alike are parsed by it; r needn't be seekable (see
+// ParseGraphDefTwoPass for a parser that doesn't keep the neighbor
+// lists).
+
+func ParseGraphDefReader(r io.Reader, popts ParseOptions) (*ParseResult, error) {
+
+    var graph []*GraphNode
+    result := new(ParseResult)
+    index := make(map[string]*GraphNode)
+    var err error
+    
+    var neighbor_spec_list []*NeighborSpec
+    labels := make(map[string]string)
+    line_count := 1
+    skipped := 0
+    
+    lineReader := bufio.NewReaderSize(r, MAX_LINE_LEN)
+    line, e := ReadFullLine(lineReader)
+    for ; e == nil; line, e = ReadFullLine(lineReader) {
+        new_node, neighbors_str, err := ParseNodeDefinition(line, line_count, labels)
+        if err != nil {
+            result.Graph = graph
+            return result, err
+        }
+        if new_node == nil {
+            skipped++
+            line_count++
+            continue
+        }
+        node, is_new, err := DefineNode(index, new_node, line_count, popts)
+        if err != nil {
+            result.Graph = graph
+            return result, err
+        }
+        if is_new {
+            graph = append(graph, new_node)
+        }
+        if neighbors_str != "" {
+            neighbor_spec := new(NeighborSpec)
+            neighbor_spec.node = node
+            neighbor_spec.neighbor_str = neighbors_str
+            neighbor_spec_list = append(neighbor_spec_list, neighbor_spec)
+        }
+        line_count++
+    }
+    if e != io.EOF {
+        result.Graph = graph
+        errstr := fmt.Sprintf("line %d: %s", line_count, e.Error())
+        return result, errors.New(errstr)
+    }
+
+    lookup := func(label string) *GraphNode {
+        return index[label]
+    }
+    result.Graph = graph
+    for _, ns := range neighbor_spec_list {
+        err = ResolveNeighbors(ns.node, ns.neighbor_str, lookup, labels)
+        if err != nil {
+            return result, err
+        }
+    }
+    if skipped > 0 {
+        warning := fmt.Sprintf("%d comment or blank lines skipped", skipped)
+        result.Warnings = append(result.Warnings, warning)
+    }
+    
+    return result, nil
+}
+
+// FUNCTION: Canonicalize
+//
+// DESCRIPTION: Reads a graph definition file from r and writes it to w
+// in canonical form: each definition as 'label: n1 n2 ...' with the
+// neighbors sorted by label, each listed once, and every edge listed
+// from both of its endpoints. Vertex weights other than 1.0 are kept.
+// Comment and blank lines are kept where they are, and a trailing
+// comment stays on its definition line. Canonicalizing a canonical
+// file changes nothing.
+
+func Canonicalize(r io.Reader, w io.Writer) error {
+    type definition struct {
+        node *GraphNode
+        comment string
+    }
+    var lines []string
+    var definitions []*definition // nil for comment and blank lines
+    index := make(map[string]*GraphNode)
+    labels := make(map[string]string)
+    var neighbor_lists []string
+
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, MAX_LINE_LEN), math.MaxInt32)
+    line_count := 0
+    for scanner.Scan() {
+        line_count++
+        line := scanner.Text()
+        new_node, neighbors_str, err := ParseNodeDefinition([]byte(line), line_count, labels)
+        if err != nil {
+            return err
+        }
+        lines = append(lines, line)
+        if new_node == nil {
+            definitions = append(definitions, nil)
+            neighbor_lists = append(neighbor_lists, "")
+            continue
+        }
+        comment := ""
+        if i := strings.IndexByte(line, '#'); i >= 0 {
+            comment = line[i:]
+        }
+        definitions = append(definitions, &definition{new_node, comment})
+        neighbor_lists = append(neighbor_lists, neighbors_str)
+        if _, ok := index[new_node.label]; ok == false {
+            index[new_node.label] = new_node
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+
+    adjacent := make(map[*GraphNode]map[*GraphNode]bool)
+    for i, def := range definitions {
+        if def == nil {
+            continue
+        }
+        for _, label := range strings.Fields(neighbor_lists[i]) {
+            neighbor := index[label]
+            if neighbor == nil {
+                errstr := fmt.Sprintf("line %d: %s: doesn't exist", i + 1, label)
+                return errors.New(errstr)
+            }
+            for _, pair := range [][2]*GraphNode{{def.node, neighbor}, {neighbor, def.node}} {
+                if adjacent[pair[0]] == nil {
+                    adjacent[pair[0]] = make(map[*GraphNode]bool)
+                }
+                adjacent[pair[0]][pair[1]] = true
+            }
+        }
+    }
+
+    for i, def := range definitions {
+        if def == nil {
+            fmt.Fprintf(w, "%s\n", lines[i])
+            continue
+        }
+        node := def.node
+        fmt.Fprintf(w, "%s", node.label)
+        if node.vertex_weight != 1.0 {
+            fmt.Fprintf(w, "[%g]", node.vertex_weight)
+        }
+        fmt.Fprintf(w, ":")
+        // a repeated definition gets the edges of the first one, which
+        // is the one its label refers to
+        var neighbors []string
+        if index[node.label] == node {
+            for n := range adjacent[node] {
+                neighbors = append(neighbors, n.label)
+            }
+        }
+        sort.Strings(neighbors)
+        for _, label := range neighbors {
+            fmt.Fprintf(w, " %s", label)
+        }
+        if def.comment != "" {
+            fmt.Fprintf(w, " %s", def.comment)
+        }
+        fmt.Fprintf(w, "\n")
+    }
+    return nil
+}
+
+// FUNCTION: CanonicalizeFile
+//
+// DESCRIPTION: Rewrites the graph definition file filename in place
+// with Canonicalize. The new contents are written to a temporary file
+// next to it that replaces it only once it is complete, so an error
+// leaves the original untouched.
+
+func CanonicalizeFile(filename string) error {
+    input, err := os.Open(filename)
+    if err != nil {
+        return err
+    }
+    defer input.Close()
+    output, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename) + ".*")
+    if err != nil {
+        return err
+    }
+    writer := bufio.NewWriter(output)
+    err = Canonicalize(input, writer)
+    if err == nil {
+        err = writer.Flush()
+    }
+    if close_err := output.Close(); err == nil {
+        err = close_err
+    }
+    if err == nil {
+        if info, stat_err := os.Stat(filename); stat_err == nil {
+            os.Chmod(output.Name(), info.Mode())
+        }
+        err = os.Rename(output.Name(), filename)
+    }
+    if err != nil {
+        os.Remove(output.Name())
+    }
+    return err
+}
+
+// FUNCTION: ParseGraphDefTwoPass
+//
+// DESCRIPTION: Parses a graph definition file the same way as
+// ParseGraphDefFile, but for files too large to hold every neighbor
+// list in memory until the end. Pass one reads the whole file and
+// creates a node for every definition; r is then rewound and pass two
+// streams through it again, resolving each line's neighbors as it is
+// read. Only the nodes and a label index are kept between the passes.
+// The memory saving needs r to be a file: standard input, tar shards
+// and -serve request bodies are first read into memory whole so that
+// they can be rewound. Repeated definitions of a vertex are handled
+// as popts says (see DefineNode).
+
+func ParseGraphDefTwoPass(r io.ReadSeeker, popts ParseOptions) (*ParseResult, error) {
+    var graph []*GraphNode
+    var defined []*GraphNode // the node of each definition, in file order
+    result := new(ParseResult)
+    index := make(map[string]*GraphNode)
+    labels := make(map[string]string)
+    skipped := 0
+
+    each_line := func(visit func(line []byte, line_count int) error) error {
+        line_count := 1
+        lineReader := bufio.NewReaderSize(r, MAX_LINE_LEN)
+        line, e := ReadFullLine(lineReader)
+        for ; e == nil; line, e = ReadFullLine(lineReader) {
+            if err := visit(line, line_count); err != nil {
+                return err
+            }
+            line_count++
+        }
+        if e != io.EOF {
+            errstr := fmt.Sprintf("line %d: %s", line_count, e.Error())
+            return errors.New(errstr)
+        }
+        return nil
+    }
+
+    err := each_line(func(line []byte, line_count int) error {
+        new_node, _, err := ParseNodeDefinition(line, line_count, labels)
+        if err != nil {
+            return err
+        }
+        if new_node == nil {
+            skipped++
+            return nil
+        }
+        node, is_new, err := DefineNode(index, new_node, line_count, popts)
+        if err != nil {
+            return err
+        }
+        if is_new {
+            graph = append(graph, new_node)
+        }
+        defined = append(defined, node)
+        return nil
+    })
+    result.Graph = graph
+    if err != nil {
+        return result, err
+    }
+    if skipped > 0 {
+        warning := fmt.Sprintf("%d comment or blank lines skipped", skipped)
+        result.Warnings = append(result.Warnings, warning)
+    }
+
+    if _, err := r.Seek(0, io.SeekStart); err != nil {
+        return result, err
+    }
+    lookup := func(label string) *GraphNode {
+        return index[label]
+    }
+    definition := 0
+    err = each_line(func(line []byte, line_count int) error {
+        new_node, neighbors_str, err := ParseNodeDefinition(line, line_count, labels)
+        if err != nil {
+            return err
+        }
+        if new_node == nil {
+            return nil
+        }
+        node := defined[definition]
+        definition++
+        if neighbors_str == "" {
+            return nil
+        }
+        return ResolveNeighbors(node, neighbors_str, lookup, labels)
+    })
+    return result, err
+}
+
+// FUNCTION: ParseLEDA
+//
+// DESCRIPTION: Parses a graph in the LEDA.GRAPH format:
+//
+// LEDA.GRAPH
+// string           -- node type
+// void             -- edge type
+// -2               -- -1 directed, -2 undirected
+// 3                -- number of nodes
+// |{v1}|           -- one line per node, numbered from 1
+// |{v2}|
+// |{v3}|
+// 3                -- number of edges
+// 1 2 0 |{}|       -- source target reversal |{edge info}|
+// 1 3 0 |{}|
+// 2 3 0 |{}|
+//
+// Lines beginning with '#' are comments. Edges of an undirected graph
+// are added in both directions; edges of a directed graph are added
+// from source to target only, just as the rhs of a graph definition
+// file does. A node with an empty label is named by its number.
+
+func ParseLEDA(r io.Reader) ([]*GraphNode, error) {
+    var graph []*GraphNode
+    var lines []string
+    var line_numbers []int
+
+    scanner := bufio.NewScanner(r)
+    line_count := 0
+    for scanner.Scan() {
+        line_count++
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        lines = append(lines, line)
+        line_numbers = append(line_numbers, line_count)
+    }
+    if err := scanner.Err(); err != nil {
+        return graph, err
+    }
+
+    syntax_error := func(i int, what string) error {
+        if i >= len(lines) {
+            return errors.New("unexpected end of file; expected " + what)
+        }
+        errstr := fmt.Sprintf("line %d: syntax error; expected %s",
+            line_numbers[i], what)
+        return errors.New(errstr)
+    }
+
+    if len(lines) == 0 || lines[0] != "LEDA.GRAPH" {
+        return graph, syntax_error(0, "LEDA.GRAPH header")
+    }
+    i := 3 // skip the header and the node and edge types
+    if i > len(lines) {
+        return graph, syntax_error(i, "node and edge types")
+    }
+
+    directed := true
+    if i < len(lines) && (lines[i] == "-1" || lines[i] == "-2") {
+        directed = lines[i] == "-1"
+        i++
+    }
+
+    if i >= len(lines) {
+        return graph, syntax_error(i, "number of nodes")
+    }
+    node_count, err := strconv.Atoi(lines[i])
+    if err != nil || node_count < 0 {
+        return graph, syntax_error(i, "number of nodes")
+    }
+    i++
+    for n := 1; n <= node_count; n, i = n + 1, i + 1 {
+        if i >= len(lines) || strings.HasPrefix(lines[i], "|{") == false ||
+            strings.HasSuffix(lines[i], "}|") == false {
+            return graph, syntax_error(i, "node |{label}|")
+        }
+        label := strings.TrimSpace(lines[i][2:len(lines[i]) - 2])
+        if label == "" {
+            label = strconv.Itoa(n)
+        }
+        graph = append(graph, NewGraphNode(label, nil))
+    }
+
+    if i >= len(lines) {
+        return graph, syntax_error(i, "number of edges")
+    }
+    edge_count, err := strconv.Atoi(lines[i])
+    if err != nil || edge_count < 0 {
+        return graph, syntax_error(i, "number of edges")
+    }
+    i++
+    for e := 0; e < edge_count; e, i = e + 1, i + 1 {
+        if i >= len(lines) {
+            return graph, syntax_error(i, "edge")
+        }
+        fields := strings.Fields(lines[i])
+        if len(fields) < 2 {
+            return graph, syntax_error(i, "edge")
+        }
+        source, err1 := strconv.Atoi(fields[0])
+        target, err2 := strconv.Atoi(fields[1])
+        if err1 != nil || err2 != nil {
+            return graph, syntax_error(i, "edge")
+        }
+        if source < 1 || source > node_count || target < 1 || target > node_count {
+            errstr := fmt.Sprintf("line %d: edge %d %d references a node that doesn't exist",
+                line_numbers[i], source, target)
+            return graph, errors.New(errstr)
+        }
+        src_node := graph[source - 1]
+        dst_node := graph[target - 1]
+        if directed {
+            if dst_node.IsConnected(src_node) == false {
+                AddNeighbor(src_node, dst_node)
+            }
+        } else {
+            AddEdge(src_node, dst_node)
+        }
+    }
+
+    return graph, nil
+}
+
+// FUNCTION: ValidWeight
+//
+// DESCRIPTION: Reports whether weight can be an edge weight: positive
+// and finite. The geometric mean taken by Intensity is -Inf or NaN for
+// anything else.
+
+func ValidWeight(weight float64) bool {
+    return weight > 0 && math.IsInf(weight, 0) == false
+}
+
+// FUNCTION: ParseTGF
+//
+// DESCRIPTION: Parses a graph in the Trivial Graph Format exported by
+// yEd: a node section of `id label` lines, a line holding just '#',
+// then an edge section of `source target [label]` lines naming nodes
+// by id. A node without a label is named by its id. Edges are taken
+// to be undirected and their labels are ignored. Blank lines are
+// skipped.
+
+func ParseTGF(r io.Reader) ([]*GraphNode, error) {
+    var graph []*GraphNode
+    nodes := make(map[string]*GraphNode)
+    in_edges := false
+
+    scanner := bufio.NewScanner(r)
+    line_count := 0
+    for scanner.Scan() {
+        line_count++
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" {
+            continue
+        }
+        if line == "#" {
+            if in_edges {
+                errstr := fmt.Sprintf("line %d: second '#' separator", line_count)
+                return graph, errors.New(errstr)
+            }
+            in_edges = true
+            continue
+        }
+        fields := strings.Fields(line)
+        if in_edges == false {
+            id := fields[0]
+            if _, ok := nodes[id]; ok {
+                errstr := fmt.Sprintf("line %d: '%s': duplicate node id", line_count, id)
+                return graph, errors.New(errstr)
+            }
+            label := strings.TrimSpace(line[len(id):])
+            if label == "" {
+                label = id
+            }
+            node := NewGraphNode(label, nil)
+            nodes[id] = node
+            graph = append(graph, node)
+            continue
+        }
+        if len(fields) < 2 {
+            errstr := fmt.Sprintf("line %d: expected source target [label]", line_count)
+            return graph, errors.New(errstr)
+        }
+        source, target := nodes[fields[0]], nodes[fields[1]]
+        for j, node := range []*GraphNode{source, target} {
+            if node == nil {
+                errstr := fmt.Sprintf("line %d: node id %s: doesn't exist",
+                    line_count, fields[j])
+                return graph, errors.New(errstr)
+            }
+        }
+        AddEdge(source, target)
+    }
+    return graph, scanner.Err()
+}
+
+// FUNCTION: ParseWeightedCSV
+//
+// DESCRIPTION: Parses a weighted edge list in CSV form, one
+// `source,target,weight` row per undirected edge. Nodes are created
+// the first time a label is seen. The weight column is optional and
+// defaults to 1.0. A first row of `source,target[,weight]`, or whose
+// weight isn't a number, is taken to be a header and skipped. Weights
+// must be positive and finite, since Intensity takes their logarithm.
+
+func ParseWeightedCSV(r io.Reader) ([]*GraphNode, error) {
+    result, err := ParseWeightedCSVResult(r)
+    return result.Graph, err
+}
+
+// FUNCTION: ParseWeightedCSVResult
+//
+// DESCRIPTION: Same as ParseWeightedCSV, but returns a ParseResult,
+// whose Unweighted counts the rows without a weight column.
+
+func ParseWeightedCSVResult(r io.Reader) (*ParseResult, error) {
+    var graph []*GraphNode
+    result := new(ParseResult)
+    nodes := make(map[string]*GraphNode)
+    get_node := func(label string) *GraphNode {
+        node, ok := nodes[label]
+        if ok == false {
+            node = NewGraphNode(label, nil)
+            nodes[label] = node
+            graph = append(graph, node)
+        }
+        return node
+    }
+
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    reader.TrimLeadingSpace = true
+    first_row := true
+    for {
+        record, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            result.Graph = graph
+            return result, err
+        }
+        line, _ := reader.FieldPos(0)
+        if len(record) < 2 || len(record) > 3 {
+            errstr := fmt.Sprintf("line %d: expected source,target[,weight]", line)
+            result.Graph = graph
+            return result, errors.New(errstr)
+        }
+        source := strings.TrimSpace(record[0])
+        target := strings.TrimSpace(record[1])
+        weight := 1.0
+        if len(record) == 3 {
+            weight, err = strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+        }
+        if first_row {
+            first_row = false
+            if err != nil || (strings.EqualFold(source, "source") &&
+                strings.EqualFold(target, "target")) {
+                continue
+            }
+        }
+        if err != nil {
+            errstr := fmt.Sprintf("line %d: %s: invalid weight", line, record[2])
+            result.Graph = graph
+            return result, errors.New(errstr)
+        }
+        if ValidWeight(weight) == false {
+            errstr := fmt.Sprintf("line %d: %s: weights must be positive", line, record[2])
+            result.Graph = graph
+            return result, errors.New(errstr)
+        }
+        if source == "" || target == "" {
+            errstr := fmt.Sprintf("line %d: empty vertex label", line)
+            result.Graph = graph
+            return result, errors.New(errstr)
+        }
+        if len(record) < 3 {
+            result.Unweighted++
+        }
+        AddWeightedEdge(get_node(source), get_node(target), weight)
+    }
+    result.Graph = graph
+    return result, nil
+}
+
+// FUNCTION: ParseNodesEdges
+//
+// DESCRIPTION: Builds a graph from separate node and edge lists in CSV
+// form, for datasets that keep vertices and topology apart. Each row
+// of nodes is `label[,weight]`, giving a vertex and optionally its
+// vertex weight; further attribute columns are ignored. A first row
+// whose weight isn't a number, or whose label is "label" or "id", is
+// a header and skipped. edges is read by ParseWeightedCSV. The graph
+// has the vertices in nodes order. An edge naming a vertex that isn't
+// in nodes is an error, unless autocreate is set, in which case the
+// vertex is added after the listed ones.
+
+func ParseNodesEdges(nodes io.Reader, edges io.Reader, autocreate bool) (*ParseResult, error) {
+    result := new(ParseResult)
+    by_label := make(map[string]*GraphNode)
+
+    reader := csv.NewReader(nodes)
+    reader.FieldsPerRecord = -1
+    reader.TrimLeadingSpace = true
+    first_row := true
+    for {
+        record, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return result, err
+        }
+        line, _ := reader.FieldPos(0)
+        label := strings.TrimSpace(record[0])
+        weight := 1.0
+        if len(record) > 1 && strings.TrimSpace(record[1]) != "" {
+            weight, err = strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+        }
+        if first_row {
+            first_row = false
+            if err != nil || strings.EqualFold(label, "label") ||
+                strings.EqualFold(label, "id") {
+                continue
+            }
+        }
+        if err != nil {
+            errstr := fmt.Sprintf("nodes: line %d: %s: invalid vertex weight",
+                line, record[1])
+            return result, errors.New(errstr)
+        }
+        if label == "" {
+            errstr := fmt.Sprintf("nodes: line %d: empty vertex label", line)
+            return result, errors.New(errstr)
+        }
+        if by_label[label] != nil {
+            errstr := fmt.Sprintf("nodes: line %d: %s: listed more than once", line, label)
+            return result, errors.New(errstr)
+        }
+        node := NewGraphNode(label, nil)
+        node.vertex_weight = weight
+        by_label[label] = node
+        result.Graph = append(result.Graph, node)
+    }
+
+    parsed, err := ParseWeightedCSVResult(edges)
+    if err != nil {
+        return result, errors.New("edges: " + err.Error())
+    }
+    for _, node := range parsed.Graph {
+        if by_label[node.label] != nil {
+            continue
+        }
+        if autocreate == false {
+            errstr := fmt.Sprintf("edges: %s: not in the nodes file", node.label)
+            return result, errors.New(errstr)
+        }
+        by_label[node.label] = NewGraphNode(node.label, nil)
+        result.Graph = append(result.Graph, by_label[node.label])
+    }
+    for _, node := range parsed.Graph {
+        for i, n := range node.neighbors {
+            AddWeightedNeighbor(by_label[node.label], by_label[n.label], node.weights[i])
+        }
+    }
+    result.Unweighted = parsed.Unweighted
+    return result, nil
+}
+
+// FUNCTION: ParseNodesEdgesFiles
+//
+// DESCRIPTION: Same as ParseNodesEdges, but reads the files at
+// nodes_filename and edges_filename, and checks and tidies the graph
+// as ParseGraphFile does, according to popts.
+
+func ParseNodesEdgesFiles(nodes_filename string, edges_filename string,
+    autocreate bool, popts ParseOptions) (*ParseResult, error) {
+
+    nodes, err := os.Open(nodes_filename)
+    if err != nil {
+        return new(ParseResult), err
+    }
+    defer nodes.Close()
+    edges, err := os.Open(edges_filename)
+    if err != nil {
+        return new(ParseResult), err
+    }
+    defer edges.Close()
+    result, err := ParseNodesEdges(nodes, edges, autocreate)
+    if err != nil {
+        return result, err
+    }
+    if err := CheckNeighborCounts(result.Graph); err != nil {
+        return result, err
+    }
+    result.Warnings = append(result.Warnings, GraphWarnings(result.Graph)...)
+    NormalizeParsed(result, popts)
+    return result, nil
+}
+
+// GraphJSON is the JSON form of a graph: its vertex labels in graph
+// order and its distinct undirected edges as label pairs. Weights,
+// when present, is parallel to Edges; it is left out when every edge
+// has the default weight of 1.0.
+type GraphJSON struct {
+    Nodes []string `json:"nodes"`
+    Edges [][2]string `json:"edges"`
+    Weights []float64 `json:"weights,omitempty"`
+}
+
+// FUNCTION: GraphToJSON
+//
+// DESCRIPTION: Converts g to its GraphJSON form.
+
+func GraphToJSON(g []*GraphNode) GraphJSON {
+    var doc GraphJSON
+    doc.Nodes = []string{}
+    doc.Edges = [][2]string{}
+    weighted := HasWeights(g)
+    for _, node := range g {
+        doc.Nodes = append(doc.Nodes, node.label)
+    }
+    for _, edge := range Edges(g) {
+        doc.Edges = append(doc.Edges, [2]string{edge[0].label, edge[1].label})
+        if weighted {
+            doc.Weights = append(doc.Weights, EdgeWeight(edge[0], edge[1]))
+        }
+    }
+    return doc
+}
+
+// ResultJSON is the JSON form of a CPMResult, every stage of the
+// pipeline in one document. Cliques are in canonical order (see
+// CliquesToJSON); Communities are in id order, so the community with
+// id 1 comes first. ParseJSON reads the graph back from it.
+type ResultJSON struct {
+    K int `json:"k"`
+    Graph GraphJSON `json:"graph"`
+    Cliques [][]string `json:"cliques"`
+    CommunityGraph GraphJSON `json:"community_graph"`
+    Communities [][]string `json:"communities"`
+    Options *OptionsRecord `json:"options,omitempty"` // with Options.RecordOptions
+    CliquesSkipped bool `json:"cliques_skipped,omitempty"` // cliques and community_graph not computed
+}
+
+// FUNCTION: CliquesToJSON
+//
+// DESCRIPTION: Returns the labels of each clique in clique_list,
+// sorted, with the cliques sorted lexicographically, so the list is
+// the same whatever order the clique search found them in.
+// clique_list itself is left as is.
+
+func CliquesToJSON(clique_list *Clique) [][]string {
+    cliques := [][]string{}
+    for item := clique_list; item != nil; item = item.next {
+        labels := []string{}
+        for _, node := range item.nodes {
+            labels = append(labels, node.label)
+        }
+        sort.Strings(labels)
+        cliques = append(cliques, labels)
+    }
+    sort.SliceStable(cliques, func(i, j int) bool {
+        a, b := cliques[i], cliques[j]
+        for n := 0; n < len(a) && n < len(b); n++ {
+            if a[n] != b[n] {
+                return a[n] < b[n]
+            }
+        }
+        return len(a) < len(b)
+    })
+    return cliques
+}
+
+// FUNCTION: WriteResultJSON
+//
+// DESCRIPTION: Writes result to w as an indented ResultJSON document.
+
+func WriteResultJSON(w io.Writer, result *CPMResult) error {
+    var doc ResultJSON
+    doc.K = result.K
+    doc.Graph = GraphToJSON(result.Graph)
+    doc.Cliques = CliquesToJSON(result.Cliques)
+    doc.CommunityGraph = GraphToJSON(result.CommunityGraph)
+    doc.CliquesSkipped = result.CliquesSkipped
+    doc.Communities = [][]string{}
+    for _, community := range result.Communities {
+        labels := []string{}
+        for _, node := range community {
+            labels = append(labels, node.label)
+        }
+        doc.Communities = append(doc.Communities, labels)
+    }
+    if result.Options.RecordOptions {
+        options := RecordOptions(result.Options)
+        doc.Options = &options
+    }
+    data, err := json.MarshalIndent(doc, "", "  ")
+    if err != nil {
+        return err
+    }
+    _, err = fmt.Fprintf(w, "%s\n", data)
+    return err
+}
+
+// FUNCTION: ParseJSON
+//
+// DESCRIPTION: Parses a graph in JSON form. r holds either a
+// GraphJSON object or a document with the graph under a "graph" key,
+// so a saved graph can be reloaded without reparsing its original
+// file. Every edge must join two vertices listed in nodes.
+
+func ParseJSON(r io.Reader) ([]*GraphNode, error) {
+    result, err := ParseJSONResult(r)
+    return result.Graph, err
+}
+
+// FUNCTION: ParseJSONResult
+//
+// DESCRIPTION: Same as ParseJSON, but returns a ParseResult, whose
+// Unweighted counts the edges given without a weight.
+
+func ParseJSONResult(r io.Reader) (*ParseResult, error) {
+    result := new(ParseResult)
+    var doc struct {
+        GraphJSON
+        Graph *GraphJSON `json:"graph"`
+    }
+    decoder := json.NewDecoder(r)
+    if err := decoder.Decode(&doc); err != nil {
+        return result, err
+    }
+    source := &doc.GraphJSON
+    if doc.Graph != nil {
+        source = doc.Graph
+    }
+    if source.Weights != nil && len(source.Weights) != len(source.Edges) {
+        errstr := fmt.Sprintf("%d weights for %d edges", len(source.Weights),
+            len(source.Edges))
+        return result, errors.New(errstr)
+    }
+    for i, weight := range source.Weights {
+        if ValidWeight(weight) == false {
+            errstr := fmt.Sprintf("edge %d: %g: weights must be positive", i + 1, weight)
+            return result, errors.New(errstr)
+        }
+    }
+
+    var graph []*GraphNode
+    nodes := make(map[string]*GraphNode)
+    for _, label := range source.Nodes {
+        if _, ok := nodes[label]; ok {
+            errstr := fmt.Sprintf("'%s': duplicate node", label)
+            result.Graph = graph
+            return result, errors.New(errstr)
+        }
+        node := NewGraphNode(label, nil)
+        nodes[label] = node
+        graph = append(graph, node)
+    }
+    for i, edge := range source.Edges {
+        a, b := nodes[edge[0]], nodes[edge[1]]
+        for j, node := range []*GraphNode{a, b} {
+            if node == nil {
+                errstr := fmt.Sprintf("%s: doesn't exist", edge[j])
+                result.Graph = graph
+                return result, errors.New(errstr)
+            }
+        }
+        if source.Weights != nil {
+            AddWeightedEdge(a, b, source.Weights[i])
+        } else {
+            AddEdge(a, b)
+            result.Unweighted++
+        }
+    }
+    result.Graph = graph
+    return result, nil
+}
+
+// GobNode is the gob form of a GraphNode. Neighbors are indexes into
+// the graph rather than pointers, since gob can't encode the cycles
+// of a neighbor list.
+type GobNode struct {
+    Label string
+    Neighbors []int
+    Weights []float64
+    VertexWeight float64
+    Virtual bool
+}
+
+// FUNCTION: SaveGob
+//
+// DESCRIPTION: Saves g to the file path with encoding/gob, so that a
+// large graph can be parsed once and then reloaded quickly with
+// LoadGob.
+
+func SaveGob(path string, g []*GraphNode) error {
+    index := make(map[*GraphNode]int)
+    for i, node := range g {
+        index[node] = i
+    }
+    nodes := make([]GobNode, len(g))
+    for i, node := range g {
+        nodes[i].Label = node.label
+        nodes[i].Weights = node.weights
+        nodes[i].VertexWeight = node.vertex_weight
+        nodes[i].Virtual = node.virtual
+        for _, n := range node.neighbors {
+            j, ok := index[n]
+            if ok == false {
+                errstr := fmt.Sprintf("%s: neighbor %s isn't in the graph",
+                    node.label, n.label)
+                return errors.New(errstr)
+            }
+            nodes[i].Neighbors = append(nodes[i].Neighbors, j)
+        }
+    }
+
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    if err := gob.NewEncoder(file).Encode(nodes); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
+
+// FUNCTION: LoadGob
+//
+// DESCRIPTION: Loads a graph saved by SaveGob.
+
+func LoadGob(path string) ([]*GraphNode, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    return DecodeGob(file)
+}
+
+// FUNCTION: DecodeGob
+//
+// DESCRIPTION: Reads a graph saved by SaveGob from r.
+
+func DecodeGob(r io.Reader) ([]*GraphNode, error) {
+    var nodes []GobNode
+    if err := gob.NewDecoder(r).Decode(&nodes); err != nil {
+        return nil, err
+    }
+    graph := make([]*GraphNode, len(nodes))
+    for i, gob_node := range nodes {
+        graph[i] = NewGraphNode(gob_node.Label, nil)
+        graph[i].vertex_weight = gob_node.VertexWeight
+        graph[i].virtual = gob_node.Virtual
+    }
+    for i, gob_node := range nodes {
+        if len(gob_node.Weights) != len(gob_node.Neighbors) {
+            errstr := fmt.Sprintf("%s: %d weights for %d neighbors", gob_node.Label,
+                len(gob_node.Weights), len(gob_node.Neighbors))
+            return graph, errors.New(errstr)
+        }
+        for j, n := range gob_node.Neighbors {
+            if n < 0 || n >= len(graph) {
+                errstr := fmt.Sprintf("%s: neighbor index %d out of range",
+                    gob_node.Label, n)
+                return graph, errors.New(errstr)
+            }
+            AddWeightedNeighbor(graph[i], graph[n], gob_node.Weights[j])
+        }
+    }
+    return graph, nil
+}
+
+// FUNCTION: ParseTar
+//
+// DESCRIPTION: Parses a tar archive, optionally gzip compressed, whose
+// regular files are shards of one graph in the graph definition file
+// format. Each shard is parsed on its own -- so every neighbor must
+// be defined in the same shard, if only as 'v9:' -- and the shards
+// are then combined with MergeGraphs. Errors and warnings name the
+// shard they come from.
+
+func ParseTar(r io.Reader, popts ParseOptions) (*ParseResult, error) {
+    result := new(ParseResult)
+    buffered := bufio.NewReader(r)
+    if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+        unzipped, err := gzip.NewReader(buffered)
+        if err != nil {
+            return result, err
+        }
+        defer unzipped.Close()
+        r = unzipped
+    } else {
+        r = buffered
+    }
+
+    var shards [][]*GraphNode
+    archive := tar.NewReader(r)
+    for {
+        header, err := archive.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return result, err
+        }
+        if header.Typeflag != tar.TypeReg {
+            continue
+        }
+        data, err := io.ReadAll(archive)
+        if err != nil {
+            return result, errors.New(fmt.Sprintf("%s: %s", header.Name, err.Error()))
+        }
+        shard, err := ParseGraphDefTwoPass(bytes.NewReader(data), popts)
+        if err != nil {
+            return result, errors.New(fmt.Sprintf("%s: %s", header.Name, err.Error()))
+        }
+        for _, warning := range shard.Warnings {
+            result.Warnings = append(result.Warnings, header.Name + ": " + warning)
+        }
+        shards = append(shards, shard.Graph)
+    }
+    result.Graph = MergeGraphs(shards...)
+    return result, nil
+}
+
+// INPUT_FORMATS lists the informat names ParseGraphFormat accepts.
+var INPUT_FORMATS = []string{"colon", "colon2", "leda", "csv", "json", "tar", "tgf", "gob"}
+
+// FUNCTION: SplitFormatSuffix
+//
+// DESCRIPTION: Splits a graph file argument of the form
+// "filename:format" into its file name and input format, so that
+// files of different formats can be merged in one run. An argument
+// with no suffix, or one naming a file that exists as given, uses
+// informat. A suffix that isn't one of INPUT_FORMATS is an error.
+
+func SplitFormatSuffix(arg string, informat string) (string, string, error) {
+    i := strings.LastIndex(arg, ":")
+    if i < 0 || arg == "-" {
+        return arg, informat, nil
+    }
+    if _, err := os.Stat(arg); err == nil {
+        return arg, informat, nil
+    }
+    filename := arg[:i]
+    suffix := arg[i + 1:]
+    for _, format := range INPUT_FORMATS {
+        if suffix == format {
+            return filename, suffix, nil
+        }
+    }
+    errstr := fmt.Sprintf("%s: unknown input format suffix %q (expected one of %s)",
+        arg, suffix, strings.Join(INPUT_FORMATS, ", "))
+    return arg, informat, errors.New(errstr)
+}
+
+// FUNCTION: ParseGraphFile
+//
+// DESCRIPTION: Parses filename according to informat, which names
+// one of the supported input formats: "colon" (the graph definition
+// file format described at the top of this file), "colon2" (the same
+// format, parsed in two passes by ParseGraphDefTwoPass), "leda",
+// "csv" (see ParseWeightedCSV), "json" (see ParseJSON), "tar"
+// (see ParseTar), "tgf" (see ParseTGF) or "gob" (see SaveGob). A
+// graph that fails CheckNeighborCounts is an error. popts is passed on
+// to the colon format parsers. The warnings of the parser are followed
+// by those of GraphWarnings, and then the graph is tidied as popts
+// says (see NormalizeParsed).
+
+func ParseGraphFile(filename string, informat string, popts ParseOptions) (*ParseResult, error) {
+    result, err := ParseGraphFormat(filename, informat, popts)
+    if err != nil {
+        return result, err
+    }
+    if err := CheckNeighborCounts(result.Graph); err != nil {
+        return result, err
+    }
+    result.Warnings = append(result.Warnings, GraphWarnings(result.Graph)...)
+    NormalizeParsed(result, popts)
+    return result, nil
+}
+
+// FUNCTION: ParseGraphFormat
+//
+// DESCRIPTION: Runs the parser for informat on filename, without the
+// GraphWarnings checks. A filename of "-" reads standard input. The
+// colon format is streamed from it like from a file; for the other
+// formats it is read into memory first, since ParseGraphReader needs
+// to seek. Only the csv and json formats can give edges explicit weights;
+// result.Unweighted counts the edges that weren't given one. A gob
+// file's weights are all taken to be explicit.
+
+func ParseGraphFormat(filename string, informat string, popts ParseOptions) (*ParseResult, error) {
+    result := new(ParseResult)
+    var file io.ReadSeeker
+    if filename == "-" && informat == "colon" {
+        result, err := ParseGraphDefReader(os.Stdin, popts)
+        result.Unweighted = EdgeCount(result.Graph)
+        return result, err
+    }
+    if filename == "-" {
+        data, err := io.ReadAll(os.Stdin)
+        if err != nil {
+            return result, err
+        }
+        file = bytes.NewReader(data)
+    } else {
+        opened, err := os.Open(filename)
+        if err != nil {
+            return result, err
+        }
+        defer opened.Close()
+        file = opened
+    }
+
+    return ParseGraphReader(file, informat, popts)
+}
+
+// FUNCTION: ParseGraphReader
+//
+// DESCRIPTION: Same as ParseGraphFormat, but parses file, which is
+// already open.
+
+func ParseGraphReader(file io.ReadSeeker, informat string, popts ParseOptions) (*ParseResult, error) {
+    result := new(ParseResult)
+    var err error
+    switch informat {
+    case "colon":
+        result, err = ParseGraphDefReader(file, popts)
+    case "colon2":
+        result, err = ParseGraphDefTwoPass(file, popts)
+    case "tar":
+        result, err = ParseTar(file, popts)
+    case "leda":
+        result.Graph, err = ParseLEDA(file)
+    case "csv":
+        return ParseWeightedCSVResult(file)
+    case "tgf":
+        result.Graph, err = ParseTGF(file)
+    case "gob":
+        result.Graph, err = DecodeGob(file)
+        return result, err
+    case "json":
+        return ParseJSONResult(file)
+    default:
+        errstr := fmt.Sprintf("%s: unknown input format", informat)
+        return result, errors.New(errstr)
+    }
+    // none of the other formats can give edge weights
+    result.Unweighted = EdgeCount(result.Graph)
+    return result, err
+}
+
+// FUNCTION: CheckNeighborCounts
+//
+// DESCRIPTION: Returns an error if any vertex of g has more distinct
+// neighbors than g has vertices. Such a vertex must be adjacent to
+// vertices outside g, so g is corrupt -- e.g. a subgraph cut out
+// without its edges -- and would make the candidate generator work on
+// vertices it can't see. Repeated neighbors count once, as
+// NormalizeParsed merges them anyway.
+
+func CheckNeighborCounts(g []*GraphNode) error {
+    for _, node := range g {
+        if len(node.neighbor_set) > len(g) {
+            errstr := fmt.Sprintf("%s: has %d distinct neighbors, but the graph has only %d vertices; corrupt input?",
+                node.label, len(node.neighbor_set), len(g))
+            return errors.New(errstr)
+        }
+    }
+    return nil
+}
+
+// CommunitiesResponse is the JSON body returned by the -serve
+// endpoint.
+type CommunitiesResponse struct {
+    K int `json:"k"`
+    Communities [][]string `json:"communities"`
+    Stats Stats `json:"stats"`
+    Warnings []string `json:"warnings,omitempty"`
+    Meta *OptionsRecord `json:"meta,omitempty"` // with Options.RecordOptions
+}
+
+// FUNCTION: CommunitiesHandler
+//
+// DESCRIPTION: Returns an HTTP handler that runs CPM on the graph
+// POSTed in the request body and responds with a CommunitiesResponse.
+// The body is parsed as informat unless the `informat` query parameter
+// names another format, and k is taken from the `k` query parameter,
+// otherwise from opts. Bodies over max_bytes are refused with 413, as
+// are graphs that exceed opts.Limits; parse errors are 400s. So that
+// one request can't keep a CPU busy indefinitely, a zero
+// opts.Limits.MaxDuration or MaxCandidates is replaced by
+// SERVE_MAX_DURATION or SERVE_MAX_CANDIDATES. popts is passed on to
+// the parser. Checkpointing is turned off.
+
+func CommunitiesHandler(opts Options, informat string, popts ParseOptions,
+    max_bytes int64) http.Handler {
+    opts.Checkpoint = ""
+    opts.Resume = ""
+    if opts.Limits.MaxDuration == 0 {
+        opts.Limits.MaxDuration = SERVE_MAX_DURATION
+    }
+    if opts.Limits.MaxCandidates == 0 {
+        opts.Limits.MaxCandidates = SERVE_MAX_CANDIDATES
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+            w.Header().Set("Allow", http.MethodPost)
+            http.Error(w, "POST a graph to this endpoint", http.StatusMethodNotAllowed)
+            return
+        }
+        request_opts := opts
+        query := r.URL.Query()
+        if value := query.Get("k"); value != "" {
+            k, err := strconv.Atoi(value)
+            if err != nil || k < 2 {
+                http.Error(w, fmt.Sprintf("k=%s: invalid clique size", value),
+                    http.StatusBadRequest)
+                return
+            }
+            request_opts.K = k
+            request_opts.MixedK = nil
+        }
+        format := informat
+        if value := query.Get("informat"); value != "" {
+            format = value
+        }
+
+        data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, max_bytes))
+        if err != nil {
+            http.Error(w, fmt.Sprintf("request body exceeds %d bytes", max_bytes),
+                http.StatusRequestEntityTooLarge)
+            return
+        }
+        parsed, err := ParseGraphReader(bytes.NewReader(data), format, popts)
+        if err == nil {
+            err = CheckNeighborCounts(parsed.Graph)
+        }
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        NormalizeParsed(parsed, popts)
+        result, err := Run(parsed.Graph, request_opts)
+        if err != nil {
+            status := http.StatusInternalServerError
+            if errors.Is(err, ErrLimitExceeded) {
+                status = http.StatusRequestEntityTooLarge
+            }
+            http.Error(w, err.Error(), status)
+            return
+        }
+
+        var response CommunitiesResponse
+        response.K = result.K
+        response.Communities = [][]string{}
+        for _, community := range result.Communities {
+            labels := []string{}
+            for _, node := range community {
+                labels = append(labels, node.label)
+            }
+            response.Communities = append(response.Communities, labels)
+        }
+        response.Stats = result.Stats
+        response.Warnings = append(parsed.Warnings, result.Warnings...)
+        if request_opts.RecordOptions {
+            options := RecordOptions(request_opts)
+            response.Meta = &options
+        }
+        var body bytes.Buffer
+        if err := json.NewEncoder(&body).Encode(response); err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        // a failed write means the client has gone; there is no one to tell
+        w.Write(body.Bytes())
+    })
+}
+
+// FUNCTION: Serve
+//
+// DESCRIPTION: Runs an HTTP server on addr (e.g. ":8080") with
+// CommunitiesHandler at /communities, until it fails. opts.Algo "bk"
+// and "gn" are refused, since only the candidate generator can be
+// bounded by the duration and candidate limits.
+
+func Serve(addr string, opts Options, informat string, popts ParseOptions,
+    max_bytes int64) error {
+    if opts.Algo == "bk" || opts.Algo == "gn" {
+        errstr := fmt.Sprintf("-serve: -algo %s can't be bounded by the clique search limits; use candidates or auto", opts.Algo)
+        return errors.New(errstr)
+    }
+    mux := http.NewServeMux()
+    mux.Handle("/communities", CommunitiesHandler(opts, informat, popts, max_bytes))
+    server := &http.Server{
+        Addr: addr,
+        Handler: mux,
+        ReadTimeout: SERVE_READ_TIMEOUT,
+    }
+    return server.ListenAndServe()
+}
+
+// FUNCTION: GraphWarnings
+//
+// DESCRIPTION: Checks a parsed graph for problems that don't stop
+// CPM from running but probably aren't what the author of the file
+// meant: a vertex listed as its own neighbor, a neighbor listed more
+// than once, and an edge listed by only one of its endpoints.
+
+func GraphWarnings(g []*GraphNode) []string {
+    var warnings []string
+    for _, node := range g {
+        seen := make(map[*GraphNode]bool)
+        for _, n := range node.neighbors {
+            switch {
+            case n == node:
+                warnings = append(warnings,
+                    fmt.Sprintf("%s: lists itself as a neighbor", node.label))
+            case seen[n]:
+                warnings = append(warnings,
+                    fmt.Sprintf("%s: lists %s more than once", node.label, n.label))
+            case node.IsConnected(n) == false:
+                warnings = append(warnings,
+                    fmt.Sprintf("%s: lists %s, but %s doesn't list %s", node.label,
+                        n.label, n.label, node.label))
             }
+            seen[n] = true
         }
     }
- 
-    community_graph := CreateCommunityGraph(clique_list, *k)
-    fmt.Printf("Community graph:\n")
-    fmt.Printf("----------------\n")
-    PrintGraph(community_graph)
+    return warnings
 }
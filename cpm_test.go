@@ -0,0 +1,2603 @@
+package cpm
+
+import "archive/tar"
+import "bytes"
+import "compress/gzip"
+import "database/sql"
+import "encoding/csv"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "io"
+import "math"
+import "net/http"
+import "net/http/httptest"
+import "os"
+import "path/filepath"
+import "reflect"
+import "regexp"
+import "sort"
+import "strconv"
+import "strings"
+import "testing"
+import "time"
+import "unsafe"
+
+// the database/sql driver for WriteSQLiteFile
+import _ "modernc.org/sqlite"
+
+// MODEL_GRAPH is the Model Graph from the comments at the top of
+// cpm.go.
+const MODEL_GRAPH = `v1: v2 v3
+v2: v1 v3
+v3: v1 v2 v4 v5
+v4: v3 v5 v6 v7
+v5: v3 v4 v6 v7
+v6: v4 v5 v7 v8
+v7: v4 v5 v6 v8
+v8: v6 v7 v9 v10
+v9: v8 v10
+v10: v8 v9
+`
+
+// modelGraph parses MODEL_GRAPH, failing the test if it can't.
+func modelGraph(t testing.TB) *Graph {
+    g, err := ParseGraph(strings.NewReader(MODEL_GRAPH))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    return g
+}
+
+// completeGraph returns the complete graph on n vertices, n0 to n<n-1>.
+func completeGraph(n int) []*GraphNode {
+    var g []*GraphNode
+    for i := 0; i < n; i++ {
+        g = append(g, NewGraphNode(fmt.Sprintf("n%d", i), nil))
+    }
+    for i := range g {
+        for j := i + 1; j < len(g); j++ {
+            AddEdge(g[i], g[j])
+        }
+    }
+    return g
+}
+
+// MODEL_COMMUNITIES are the k=3 communities of the Model Graph, as
+// communityStrings gives them.
+var MODEL_COMMUNITIES = []string{"v1 v2 v3", "v10 v8 v9", "v3 v4 v5 v6 v7 v8"}
+
+// communityStrings returns each community as its sorted labels joined
+// by spaces, in sorted order, so that results can be compared whatever
+// order they were found in.
+func communityStrings(communities [][]*GraphNode) []string {
+    strs := []string{}
+    for _, community := range communities {
+        labels := NodeLabels(community)
+        sort.Strings(labels)
+        strs = append(strs, strings.Join(labels, " "))
+    }
+    sort.Strings(strs)
+    return strs
+}
+
+// runModel runs CPM on the Model Graph with the given options.
+func runModel(t testing.TB, options ...Option) *CPMResult {
+    result, err := Run(modelGraph(t).Nodes, NewOptions(options...))
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    return result
+}
+
+func TestDumpIntermediate(t *testing.T) {
+    dir := t.TempDir()
+    if err := DumpIntermediate(dir, runModel(t)); err != nil {
+        t.Fatalf("DumpIntermediate: %s", err.Error())
+    }
+    read := func(filename string) []string {
+        data, err := os.ReadFile(filepath.Join(dir, filename))
+        if err != nil {
+            t.Fatalf("%s", err.Error())
+        }
+        return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+    }
+
+    graph, err := ParseGraph(strings.NewReader(strings.Join(read("graph.txt"), "\n")))
+    if err != nil {
+        t.Fatalf("graph.txt: %s", err.Error())
+    }
+    if len(graph.Nodes) != 10 || EdgeCount(graph.Nodes) != 16 {
+        t.Errorf("graph.txt: %d nodes and %d edges, want 10 and 16", len(graph.Nodes),
+            EdgeCount(graph.Nodes))
+    }
+
+    cliques := read("cliques.txt")
+    if len(cliques) != 8 {
+        t.Errorf("cliques.txt: %d cliques, want 8", len(cliques))
+    }
+    for _, line := range cliques {
+        fields := strings.Fields(line)
+        if len(fields) != 4 || strings.HasSuffix(fields[0], ":") == false {
+            t.Errorf("cliques.txt: %q: want an id and 3 vertices", line)
+        }
+    }
+
+    community_graph := read("community_graph.txt")
+    if len(community_graph) != 8 {
+        t.Errorf("community_graph.txt: %d nodes, want 8", len(community_graph))
+    }
+    for _, line := range community_graph {
+        label, _, found := strings.Cut(line, ":")
+        if found == false || strings.Count(label, ",") != 2 {
+            t.Errorf("community_graph.txt: %q: want a clique label and its neighbors", line)
+        }
+    }
+
+    var communities [][]*GraphNode
+    for i, line := range read("communities.txt") {
+        prefix := fmt.Sprintf("Community %d:", i + 1)
+        if strings.HasPrefix(line, prefix) == false {
+            t.Fatalf("communities.txt: %q: want %q", line, prefix)
+        }
+        var community []*GraphNode
+        for _, label := range strings.Fields(strings.TrimPrefix(line, prefix)) {
+            community = append(community, NewGraphNode(label, nil))
+        }
+        communities = append(communities, community)
+    }
+    if got := communityStrings(communities); reflect.DeepEqual(got, MODEL_COMMUNITIES) == false {
+        t.Errorf("communities.txt: %q, want %q", got, MODEL_COMMUNITIES)
+    }
+}
+
+func TestInducedSubgraph(t *testing.T) {
+    g := modelGraph(t).Nodes
+    nodes, err := SelectNodes(g, []string{"v1", "v2", " v3"})
+    if err != nil {
+        t.Fatalf("SelectNodes: %s", err.Error())
+    }
+    triangle := InducedSubgraph(nodes)
+    if len(triangle) != 3 || EdgeCount(triangle) != 3 {
+        t.Fatalf("%d nodes and %d edges, want a triangle", len(triangle), EdgeCount(triangle))
+    }
+    for _, node := range triangle {
+        for _, n := range node.neighbors {
+            if n != GetNode(triangle, n.label) {
+                t.Errorf("%s: neighbor %s is outside the subgraph", node.label, n.label)
+            }
+        }
+    }
+    result, err := Run(triangle, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, []string{"v1 v2 v3"}) == false {
+        t.Errorf("communities %q, want the triangle", got)
+    }
+
+    if _, err := SelectNodes(g, []string{"v1", "v11"}); err == nil {
+        t.Errorf("SelectNodes: v11 accepted")
+    }
+}
+
+func TestWithAccept(t *testing.T) {
+    without_v9 := func(nodes []*GraphNode) bool {
+        for _, node := range nodes {
+            if node.label == "v9" {
+                return false
+            }
+        }
+        return true
+    }
+    result := runModel(t, WithAccept(without_v9))
+    for item := result.Cliques; item != nil; item = item.next {
+        if without_v9(item.nodes) == false {
+            t.Errorf("clique %q was not rejected", item.Labels())
+        }
+    }
+    want := []string{"v1 v2 v3", "v3 v4 v5 v6 v7 v8"}
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, want) == false {
+        t.Errorf("communities %q, want %q", got, want)
+    }
+}
+
+func TestCommunitiesOf(t *testing.T) {
+    result := runModel(t)
+    for _, test := range []struct {
+        label string
+        count int
+    }{{"v3", 2}, {"v8", 2}, {"v1", 1}, {"v5", 1}, {"v11", 0}} {
+        ids := result.CommunitiesOf(test.label)
+        if len(ids) != test.count {
+            t.Errorf("%s: in communities %v, want %d of them", test.label, ids, test.count)
+        }
+        for _, id := range ids {
+            if GetNode(result.Communities[id - 1], test.label) == nil {
+                t.Errorf("%s: community %d doesn't contain it", test.label, id)
+            }
+        }
+    }
+}
+
+func TestParseLEDA(t *testing.T) {
+    file, err := os.Open("examples/model.gw")
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    defer file.Close()
+    g, err := ParseLEDA(file)
+    if err != nil {
+        t.Fatalf("ParseLEDA: %s", err.Error())
+    }
+    got := CliqueKeys(FindKCliques(g, 3))
+    want := CliqueKeys(FindKCliques(modelGraph(t).Nodes, 3))
+    if reflect.DeepEqual(got, want) == false {
+        t.Errorf("cliques %q, want %q", got, want)
+    }
+}
+
+func TestExplainCommunity(t *testing.T) {
+    result := runModel(t, WithRepeatable(true))
+    id := result.CommunitiesOf("v5")[0]
+    var out bytes.Buffer
+    if err := ExplainCommunity(&out, result, id); err != nil {
+        t.Fatalf("ExplainCommunity: %s", err.Error())
+    }
+    lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+    header := fmt.Sprintf("Community %d percolates through 6 cliques:", id)
+    if len(lines) != 7 || lines[0] != header {
+        t.Fatalf("want %q and a line for each clique, got:\n%s", header, out.String())
+    }
+    if strings.Contains(lines[1], " -- ") {
+        t.Errorf("%q: the root clique links to nothing", lines[1])
+    }
+    for _, line := range lines[2:] {
+        if strings.Contains(line, " -- ") == false || strings.Contains(line, "(shared: ") == false {
+            t.Errorf("%q: want a link with the shared vertices", line)
+        }
+    }
+
+    if err := ExplainCommunity(&out, result, 4); err == nil {
+        t.Errorf("community 4 of 3 explained")
+    }
+    merged := runModel(t, WithMergeThreshold(0.1))
+    for id, component := range merged.Components {
+        if component == MERGED_COMPONENT {
+            if err := ExplainCommunity(&out, merged, id + 1); err == nil {
+                t.Errorf("merged community %d explained", id + 1)
+            }
+            return
+        }
+    }
+    t.Errorf("-merge-threshold 0.1 merged nothing")
+}
+
+func TestLimits(t *testing.T) {
+    for _, test := range []struct {
+        name string
+        limits Limits
+    }{
+        {"nodes", Limits{MaxNodes: 9}},
+        {"edges", Limits{MaxEdges: 15}},
+        {"cliques", Limits{MaxCliques: 2}},
+        {"candidates", Limits{MaxCandidates: 1}},
+        {"duration", Limits{MaxDuration: time.Nanosecond}},
+    } {
+        _, err := Run(modelGraph(t).Nodes, NewOptions(WithLimits(test.limits)))
+        if errors.Is(err, ErrLimitExceeded) == false {
+            t.Errorf("%s: error %v, want ErrLimitExceeded", test.name, err)
+        }
+    }
+    limits := Limits{MaxNodes: 10, MaxEdges: 16, MaxCliques: 8}
+    if _, err := Run(modelGraph(t).Nodes, NewOptions(WithLimits(limits))); err != nil {
+        t.Errorf("limits at the graph's size: %s", err.Error())
+    }
+}
+
+func TestWriteSQLiteFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "cpm.db")
+    result := runModel(t)
+    // a second run replaces the rows of the first
+    for run := 1; run <= 2; run++ {
+        if err := WriteSQLiteFile(path, result); err != nil {
+            t.Fatalf("run %d: WriteSQLiteFile: %s", run, err.Error())
+        }
+    }
+    db, err := sql.Open("sqlite", path)
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    defer db.Close()
+    for _, test := range []struct {
+        query string
+        want int
+    }{
+        {"SELECT COUNT(DISTINCT community_id) FROM communities", 3},
+        {"SELECT COUNT(*) FROM nodes", 10},
+        {"SELECT COUNT(*) FROM edges", 16},
+        {"SELECT COUNT(DISTINCT clique_id) FROM cliques", 8},
+    } {
+        var got int
+        if err := db.QueryRow(test.query).Scan(&got); err != nil {
+            t.Fatalf("%s: %s", test.query, err.Error())
+        }
+        if got != test.want {
+            t.Errorf("%s: %d, want %d", test.query, got, test.want)
+        }
+    }
+}
+
+func TestVerifyCliques(t *testing.T) {
+    // read as directed, c doesn't list b, yet a, b and c are taken for
+    // a clique, because MakeCliqueList checks each pair one way
+    g, err := NewGraphBuilder().Directed().
+        Node("a", "b", "c").Node("b", "a", "c").Node("c", "a").Build()
+    if err != nil {
+        t.Fatalf("Build: %s", err.Error())
+    }
+    problems := VerifyCliques(FindKCliques(g, 3))
+    if len(problems) != 1 || strings.Contains(problems[0], "c and b are not connected") == false {
+        t.Errorf("problems %q, want c and b reported", problems)
+    }
+    if problems := VerifyCliques(runModel(t).Cliques); len(problems) != 0 {
+        t.Errorf("Model Graph: problems %q", problems)
+    }
+}
+
+func TestBipartiteGraph(t *testing.T) {
+    result := runModel(t)
+    bipartite := BipartiteGraph(result.Communities)
+    vertices := 0
+    for _, node := range bipartite {
+        if strings.HasPrefix(node.label, "c") {
+            continue
+        }
+        vertices++
+        var want []string
+        for _, id := range result.Membership[node.label] {
+            want = append(want, fmt.Sprintf("c%d", id))
+        }
+        if got := NodeLabels(node.neighbors); reflect.DeepEqual(got, want) == false {
+            t.Errorf("%s: edges to %q, want %q", node.label, got, want)
+        }
+    }
+    if vertices != len(result.Membership) {
+        t.Errorf("%d vertex nodes, want %d", vertices, len(result.Membership))
+    }
+}
+
+func TestMergeSimilarCommunities(t *testing.T) {
+    g, _ := NewGraphBuilder().Node("a").Node("b").Node("c").Node("d").Node("e").
+        Node("f").Node("x").Node("y").Node("z").Build()
+    nodes := func(labels ...string) []*GraphNode {
+        selected, err := SelectNodes(g, labels)
+        if err != nil {
+            t.Fatalf("SelectNodes: %s", err.Error())
+        }
+        return selected
+    }
+    communities := [][]*GraphNode{nodes("a", "b", "c", "d", "e"), nodes("x", "y", "z"),
+        nodes("a", "b", "c", "d", "f")}
+    // the first and last share 4 of 6 vertices
+    merged, components := MergeSimilarCommunities(communities, []int{0, 1, 2}, 0.5)
+    want := []string{"a b c d e f", "x y z"}
+    if got := communityStrings(merged); reflect.DeepEqual(got, want) == false {
+        t.Errorf("communities %q, want %q", got, want)
+    }
+    if reflect.DeepEqual(components, []int{MERGED_COMPONENT, 1}) == false {
+        t.Errorf("components %v, want [%d 1]", components, MERGED_COMPONENT)
+    }
+}
+
+func TestRunResult(t *testing.T) {
+    result := runModel(t)
+    if result.K != 3 || len(result.Graph) != 10 || CountCliques(result.Cliques) != 8 ||
+        len(result.CommunityGraph) != 8 {
+        t.Errorf("k %d, %d nodes, %d cliques, %d community graph nodes, want 3, 10, 8 and 8",
+            result.K, len(result.Graph), CountCliques(result.Cliques), len(result.CommunityGraph))
+    }
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, MODEL_COMMUNITIES) == false {
+        t.Errorf("communities %q, want %q", got, MODEL_COMMUNITIES)
+    }
+    if reflect.DeepEqual(result.Components, []int{0, 1, 2}) == false {
+        t.Errorf("components %v, want [0 1 2]", result.Components)
+    }
+    if len(result.Membership) != 10 || len(result.Membership["v3"]) != 2 {
+        t.Errorf("membership %v, want all 10 vertices and v3 in 2 communities", result.Membership)
+    }
+    if want := (Stats{Nodes: 10, Edges: 16, Cliques: 8, Communities: 3}); result.Stats != want {
+        t.Errorf("stats %+v, want %+v", result.Stats, want)
+    }
+    if len(result.NodeTimings) != 10 || len(result.Uncovered) != 0 || len(result.Warnings) != 0 {
+        t.Errorf("%d timings, uncovered %q, warnings %q, want 10 and none", len(result.NodeTimings),
+            NodeLabels(result.Uncovered), result.Warnings)
+    }
+}
+
+func TestParseWeightedCSV(t *testing.T) {
+    parsed, err := ParseWeightedCSVResult(strings.NewReader("source,target,weight\na,b,0.5\nb, c, 2\na,c\n"))
+    if err != nil {
+        t.Fatalf("ParseWeightedCSVResult: %s", err.Error())
+    }
+    g := parsed.Graph
+    a, b, c := GetNode(g, "a"), GetNode(g, "b"), GetNode(g, "c")
+    if len(g) != 3 || a == nil || b == nil || c == nil {
+        t.Fatalf("nodes %q, want a, b and c", NodeLabels(g))
+    }
+    for _, test := range []struct {
+        x, y *GraphNode
+        want float64
+    }{{a, b, 0.5}, {b, a, 0.5}, {b, c, 2}, {c, b, 2}, {a, c, 1}} {
+        if got := EdgeWeight(test.x, test.y); got != test.want {
+            t.Errorf("%s-%s: weight %g, want %g", test.x.label, test.y.label, got, test.want)
+        }
+    }
+    if parsed.Unweighted != 1 {
+        t.Errorf("%d unweighted edges, want 1", parsed.Unweighted)
+    }
+
+    for _, weight := range []string{"0", "-1", "NaN", "Inf"} {
+        _, err := ParseWeightedCSV(strings.NewReader("a,b,1\nb,c," + weight + "\n"))
+        if err == nil || strings.Contains(err.Error(), "weights must be positive") == false {
+            t.Errorf("weight %s: error %v, want it refused", weight, err)
+        }
+    }
+}
+
+func TestForceConnected(t *testing.T) {
+    g, _ := NewGraphBuilder().Node("a", "b", "c").Node("b", "c").
+        Node("x", "y", "z").Node("y", "z").Build()
+    if n := len(ConnectedComponents(g)); n != 2 {
+        t.Fatalf("%d components, want 2", n)
+    }
+    connected := ForceConnected(g)
+    if n := len(ConnectedComponents(connected)); n != 1 {
+        t.Errorf("%d components after ForceConnected, want 1", n)
+    }
+    result, err := Run(connected, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    want := []string{"a b c", "x y z"}
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, want) == false {
+        t.Errorf("communities %q, want %q", got, want)
+    }
+    var out bytes.Buffer
+    if err := WriteResult(&out, "text", result); err != nil {
+        t.Fatalf("WriteResult: %s", err.Error())
+    }
+    _, communities, _ := strings.Cut(out.String(), "Communities:")
+    if strings.Contains(communities, "<hub>") {
+        t.Errorf("the hub is in the communities:%s", communities)
+    }
+    if ForceConnected(connected)[len(connected) - 1] != connected[len(connected) - 1] ||
+        len(ForceConnected(connected)) != len(connected) {
+        t.Errorf("a connected graph was changed")
+    }
+}
+
+// repeatedLabelsGraph returns a graph definition of n vertices, each
+// listing the same few hubs, so that most labels read are repeats.
+func repeatedLabelsGraph(n int) string {
+    var def strings.Builder
+    fmt.Fprintf(&def, "hub_a: hub_b hub_c\nhub_b: hub_a hub_c\nhub_c: hub_a hub_b\n")
+    for i := 0; i < n; i++ {
+        fmt.Fprintf(&def, "v%d: hub_a hub_b hub_c\n", i)
+    }
+    return def.String()
+}
+
+func TestIntern(t *testing.T) {
+    table := make(map[string]string)
+    first := Intern(table, string([]byte("hub_a")))
+    second := Intern(table, string([]byte("hub_a")))
+    if unsafe.StringData(first) != unsafe.StringData(second) {
+        t.Errorf("two reads of hub_a have separate copies")
+    }
+
+    parsed, err := ParseGraphDefReader(strings.NewReader(repeatedLabelsGraph(100)), ParseOptions{})
+    if err != nil {
+        t.Fatalf("ParseGraphDefReader: %s", err.Error())
+    }
+    hub := GetNode(parsed.Graph, "hub_a")
+    for _, node := range parsed.Graph {
+        for _, n := range node.neighbors {
+            if n.label == "hub_a" && n != hub {
+                t.Fatalf("%s lists a second hub_a node", node.label)
+            }
+        }
+    }
+}
+
+func BenchmarkParseRepeatedLabels(b *testing.B) {
+    def := repeatedLabelsGraph(10000)
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        if _, err := ParseGraphDefReader(strings.NewReader(def), ParseOptions{}); err != nil {
+            b.Fatalf("%s", err.Error())
+        }
+    }
+}
+
+func TestTriangles(t *testing.T) {
+    for _, g := range [][]*GraphNode{modelGraph(t).Nodes, completeGraph(6)} {
+        var got []string
+        for _, triangle := range Triangles(g) {
+            labels := triangle[:]
+            sort.Strings(labels)
+            got = append(got, strings.Join(labels, " "))
+        }
+        sort.Strings(got)
+        if want := CliqueKeys(FindKCliques(g, 3)); reflect.DeepEqual(got, want) == false {
+            t.Errorf("triangles %q, want %q", got, want)
+        }
+    }
+}
+
+func TestWriteCommunityDOTFiles(t *testing.T) {
+    dir := t.TempDir()
+    result := runModel(t)
+    if err := WriteCommunityDOTFiles(dir, result); err != nil {
+        t.Fatalf("WriteCommunityDOTFiles: %s", err.Error())
+    }
+    files, _ := filepath.Glob(filepath.Join(dir, "*"))
+    if len(files) != 3 {
+        t.Fatalf("files %q, want one per community", files)
+    }
+    quoted := regexp.MustCompile(`"([^"]*)"`)
+    for i, community := range result.Communities {
+        data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("community-%d.dot", i + 1)))
+        if err != nil {
+            t.Fatalf("%s", err.Error())
+        }
+        seen := make(map[string]bool)
+        for _, match := range quoted.FindAllStringSubmatch(string(data), -1) {
+            seen[match[1]] = true
+        }
+        var got []string
+        for label := range seen {
+            got = append(got, label)
+        }
+        sort.Strings(got)
+        want := NodeLabels(community)
+        sort.Strings(want)
+        if reflect.DeepEqual(got, want) == false {
+            t.Errorf("community-%d.dot: vertices %q, want %q", i + 1, got, want)
+        }
+    }
+}
+
+func TestFprintWeightedGraph(t *testing.T) {
+    g, err := ParseWeightedCSV(strings.NewReader("a,b,0.5\nb,c,2\n"))
+    if err != nil {
+        t.Fatalf("ParseWeightedCSV: %s", err.Error())
+    }
+    var out bytes.Buffer
+    FprintWeightedGraph(&out, g, true)
+    want := "a:  b(0.5) \nb:  a(0.5) c(2) \nc:  b(2) \n"
+    if out.String() != want {
+        t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+    }
+    out.Reset()
+    FprintWeightedGraph(&out, g, false)
+    if want := "a:  b \nb:  a c \nc:  b \n"; out.String() != want {
+        t.Errorf("without weights got\n%s\nwant\n%s", out.String(), want)
+    }
+}
+
+func TestUpdateCliques(t *testing.T) {
+    for _, k := range []int{2, 3, 4} {
+        g := modelGraph(t).Nodes
+        clique_list := FindKCliques(g, k)
+        var added [][2]*GraphNode
+        for _, pair := range [][2]string{{"v2", "v4"}, {"v1", "v4"}, {"v8", "v5"}, {"v3", "v6"}} {
+            added = append(added, [2]*GraphNode{GetNode(g, pair[0]), GetNode(g, pair[1])})
+        }
+        got := CliqueKeys(UpdateCliques(g, clique_list, added, k))
+        if want := CliqueKeys(FindKCliques(g, k)); reflect.DeepEqual(got, want) == false {
+            t.Errorf("k=%d: updated %q, recomputed %q", k, got, want)
+        }
+    }
+}
+
+func TestVertexWeight(t *testing.T) {
+    def := "a[2]: b c\nb[3]: a c\nc: a b d e\nd[0.5]: c e\ne[4]: c d\n"
+    parsed, err := ParseGraphDefReader(strings.NewReader(def), ParseOptions{})
+    if err != nil {
+        t.Fatalf("ParseGraphDefReader: %s", err.Error())
+    }
+    result, err := Run(parsed.Graph, NewOptions(WithRepeatable(true)))
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    want := map[string]float64{"a b c": 6, "c d e": 5.5}
+    for _, community := range result.Communities {
+        key := communityStrings([][]*GraphNode{community})[0]
+        if got := VertexWeight(community); got != want[key] {
+            t.Errorf("%s: vertex weight %g, want %g", key, got, want[key])
+        }
+    }
+    if len(result.Communities) != 2 {
+        t.Errorf("%d communities, want 2", len(result.Communities))
+    }
+}
+
+func TestDropContainedCliques(t *testing.T) {
+    g := completeGraph(6)
+    triangle := NewClique(g[:3])
+    four := NewClique(g[:4])
+    other := NewClique(g[3:6])
+    triangle.next = four
+    four.next = other
+    got := CliqueKeys(DropContainedCliques(triangle))
+    want := []string{"n0 n1 n2 n3", "n3 n4 n5"}
+    if reflect.DeepEqual(got, want) == false {
+        t.Errorf("cliques %q, want %q", got, want)
+    }
+}
+
+func TestFprintASCIIGraph(t *testing.T) {
+    // three triangles in a chain: a community graph of three nodes
+    g, _ := NewGraphBuilder().Node("a", "b", "c").Node("b", "c", "d").
+        Node("c", "d", "e").Node("d", "e").Build()
+    result, err := Run(g, NewOptions(WithRepeatable(true)))
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    var out bytes.Buffer
+    FprintASCIIGraph(&out, result.CommunityGraph)
+    want := `+-------+
+| a,b,c |--+-- b,c,d
++-------+
++-------+
+| b,c,d |--+-- a,b,c
++-------+  +-- c,d,e
++-------+
+| c,d,e |--+-- b,c,d
++-------+
+`
+    if out.String() != want {
+        t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+    }
+}
+
+func TestWriteMatrixMarket(t *testing.T) {
+    var out bytes.Buffer
+    WriteMatrixMarket(&out, modelGraph(t).Nodes)
+    lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+    if lines[0] != "%%MatrixMarket matrix coordinate real general" {
+        t.Errorf("header %q", lines[0])
+    }
+    var body []string
+    for _, line := range lines[1:] {
+        if strings.HasPrefix(line, "%") == false {
+            body = append(body, line)
+        }
+    }
+    // 16 undirected edges are 32 entries of the symmetric matrix
+    if len(body) == 0 || body[0] != "10 10 32" {
+        t.Fatalf("size line %q, want \"10 10 32\"", body)
+    }
+    if len(body) - 1 != 32 {
+        t.Errorf("%d entries, want 32", len(body) - 1)
+    }
+    for _, entry := range body[1:] {
+        var i, j int
+        var weight float64
+        if n, _ := fmt.Sscanf(entry, "%d %d %g", &i, &j, &weight); n != 3 ||
+            i < 1 || i > 10 || j < 1 || j > 10 {
+            t.Errorf("entry %q", entry)
+        }
+    }
+}
+
+func TestRepeatable(t *testing.T) {
+    lines := strings.SplitAfter(MODEL_GRAPH, "\n")
+    reversed := ""
+    for i := len(lines) - 1; i >= 0; i-- {
+        reversed += lines[i]
+    }
+    var outputs []string
+    for _, def := range []string{MODEL_GRAPH, MODEL_GRAPH, reversed} {
+        g, err := ParseGraph(strings.NewReader(def))
+        if err != nil {
+            t.Fatalf("ParseGraph: %s", err.Error())
+        }
+        result, err := Run(g.Nodes, NewOptions(WithRepeatable(true)))
+        if err != nil {
+            t.Fatalf("Run: %s", err.Error())
+        }
+        var out bytes.Buffer
+        if err := WriteResult(&out, "text", result); err != nil {
+            t.Fatalf("WriteResult: %s", err.Error())
+        }
+        outputs = append(outputs, out.String())
+    }
+    if outputs[1] != outputs[0] {
+        t.Errorf("second run differs:\n%s\nfirst:\n%s", outputs[1], outputs[0])
+    }
+    if outputs[2] != outputs[0] {
+        t.Errorf("reversed input differs:\n%s\nfirst:\n%s", outputs[2], outputs[0])
+    }
+}
+
+func TestConductance(t *testing.T) {
+    result := runModel(t)
+    // {v1, v2, v3}: 2 boundary edges (v3-v4, v3-v5) over a volume of
+    // 2*3 + 2; {v3, ..., v8}: 4 boundary edges over 2*10 + 4
+    want := map[string]float64{"v1 v2 v3": 2.0 / 8, "v10 v8 v9": 2.0 / 8,
+        "v3 v4 v5 v6 v7 v8": 4.0 / 24}
+    for _, community := range result.Communities {
+        key := communityStrings([][]*GraphNode{community})[0]
+        if got := Conductance(result.Graph, community); math.Abs(got - want[key]) > 1e-9 {
+            t.Errorf("%s: conductance %g, want %g", key, got, want[key])
+        }
+    }
+    if got := Conductance(result.Graph, result.Graph); got != 0 {
+        t.Errorf("whole graph: conductance %g, want 0", got)
+    }
+}
+
+func TestParseGraphDefTwoPass(t *testing.T) {
+    file, err := os.Open("examples/model.txt")
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    defer file.Close()
+    two_pass, err := ParseGraphDefTwoPass(file, ParseOptions{})
+    if err != nil {
+        t.Fatalf("ParseGraphDefTwoPass: %s", err.Error())
+    }
+    file.Seek(0, io.SeekStart)
+    one_pass, err := ParseGraphDefReader(file, ParseOptions{})
+    if err != nil {
+        t.Fatalf("ParseGraphDefReader: %s", err.Error())
+    }
+    var got, want bytes.Buffer
+    FprintGraph(&got, two_pass.Graph)
+    FprintGraph(&want, one_pass.Graph)
+    if got.String() != want.String() {
+        t.Errorf("two passes:\n%s\none pass:\n%s", got.String(), want.String())
+    }
+    if reflect.DeepEqual(two_pass.Warnings, one_pass.Warnings) == false {
+        t.Errorf("warnings %q and %q", two_pass.Warnings, one_pass.Warnings)
+    }
+}
+
+func TestSlowestNodes(t *testing.T) {
+    // a star of 60 leaves, joined in pairs so there are triangles
+    builder := NewGraphBuilder()
+    for i := 0; i < 60; i++ {
+        builder.Node("hub", fmt.Sprintf("leaf%d", i))
+        builder.Node(fmt.Sprintf("leaf%d", i), fmt.Sprintf("leaf%d", i ^ 1))
+    }
+    g, _ := builder.Build()
+    _, timings, err := FindTimedKCliques(g, 3, nil, Limits{})
+    if err != nil {
+        t.Fatalf("FindTimedKCliques: %s", err.Error())
+    }
+    slowest := SlowestNodes(timings, 3)
+    if len(slowest) != 3 || slowest[0].Node.label != "hub" {
+        t.Errorf("slowest %v, want the hub first", slowest)
+    }
+}
+
+func TestResume(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "checkpoint.json")
+    g := modelGraph(t).Nodes
+    // stop the search at its first checkpoint, after 4 nodes
+    var search CliqueSearch
+    search.K = 3
+    search.CheckpointEvery = 4
+    interrupted := errors.New("interrupted")
+    search.OnCheckpoint = func(next int, clique_list *Clique) error {
+        if err := WriteCheckpoint(path, g, 3, next, clique_list); err != nil {
+            return err
+        }
+        return interrupted
+    }
+    if _, _, err := SearchKCliques(g, search); err != interrupted {
+        t.Fatalf("error %v, want the interruption", err)
+    }
+
+    resumed, err := Run(g, NewOptions(WithResume(path)))
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if len(resumed.NodeTimings) != len(g) - 4 {
+        t.Errorf("%d nodes examined after resuming, want %d", len(resumed.NodeTimings),
+            len(g) - 4)
+    }
+    got := CliqueKeys(resumed.Cliques)
+    if want := CliqueKeys(runModel(t).Cliques); reflect.DeepEqual(got, want) == false {
+        t.Errorf("resumed cliques %q, want %q", got, want)
+    }
+
+    if _, err := Run(g, NewOptions(WithK(4), WithResume(path))); err == nil {
+        t.Errorf("a k=3 checkpoint resumed a k=4 search")
+    }
+}
+
+func TestWriteIndexMap(t *testing.T) {
+    g := modelGraph(t).Nodes
+    var out bytes.Buffer
+    WriteIndexMap(&out, g)
+    labels := make(map[string]bool)
+    indexes := make(map[int]bool)
+    for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+        label, index_str, found := strings.Cut(line, "\t")
+        index, err := strconv.Atoi(index_str)
+        if found == false || err != nil || index < 1 || index > len(g) {
+            t.Fatalf("%q: want label<TAB>index in 1..%d", line, len(g))
+        }
+        if labels[label] || indexes[index] {
+            t.Errorf("%q: label or index repeated", line)
+        }
+        labels[label] = true
+        indexes[index] = true
+    }
+    if len(labels) != len(g) {
+        t.Errorf("%d labels mapped, want all %d", len(labels), len(g))
+    }
+    for _, node := range g {
+        if labels[node.label] == false {
+            t.Errorf("%s: not mapped", node.label)
+        }
+    }
+}
+
+func TestUnicodeLabels(t *testing.T) {
+    // precomposed é (NFC) and e + combining acute are different labels;
+    // see LABEL_RE
+    nfc, nfd := "caf\u00e9", "cafe\u0301"
+    def := nfc + ": 東京 x\n東京: " + nfc + " x\nx: " + nfc + " 東京 " + nfd + "\n" + nfd + ": x\n"
+    g, err := ParseGraph(strings.NewReader(def))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    if len(g.Nodes) != 4 || GetNode(g.Nodes, nfc) == nil || GetNode(g.Nodes, nfd) == nil {
+        t.Fatalf("nodes %q, want %q and %q apart", NodeLabels(g.Nodes), nfc, nfd)
+    }
+    want := []string{strings.Join([]string{nfc, "x", "東京"}, " ")}
+    if got := CliqueKeys(FindKCliques(g.Nodes, 3)); reflect.DeepEqual(got, want) == false {
+        t.Errorf("cliques %q, want %q", got, want)
+    }
+}
+
+func TestCompareCliques(t *testing.T) {
+    fixtures := map[string][]*GraphNode{
+        "model": modelGraph(t).Nodes,
+        "complete": completeGraph(7),
+    }
+    file, err := os.Open("examples/model.tgf")
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    fixtures["tgf"], err = ParseTGF(file)
+    file.Close()
+    if err != nil {
+        t.Fatalf("ParseTGF: %s", err.Error())
+    }
+    for name, g := range fixtures {
+        for k := 2; k <= 4; k++ {
+            same, difference := CompareCliques(FindKCliques(g, k), "candidates",
+                BronKerboschKCliques(g, k), "bk")
+            if same == false {
+                t.Errorf("%s, k=%d: %s", name, k, difference)
+            }
+        }
+    }
+    g := modelGraph(t).Nodes
+    if same, _ := CompareCliques(FindKCliques(g, 3), "a", FindKCliques(g, 4), "b"); same {
+        t.Errorf("3-cliques and 4-cliques compared the same")
+    }
+}
+
+func TestTrailingComments(t *testing.T) {
+    def := "# the Model Graph's first triangle\n" +
+        "v1: v2 v3 # core triangle\n" +
+        "v2: v1 v3#no space\n" +
+        "\n" +
+        "v3: v1 v2 # v4 isn't a neighbor\n" +
+        "v4: # no neighbors\n"
+    g, err := ParseGraph(strings.NewReader(def))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    want := "v1:  v2 v3 \nv2:  v1 v3 \nv3:  v1 v2 \nv4:  \n"
+    var out bytes.Buffer
+    FprintGraph(&out, g.Nodes)
+    if out.String() != want {
+        t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+    }
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+    result := runModel(t)
+    var out bytes.Buffer
+    if err := WriteResultJSON(&out, result); err != nil {
+        t.Fatalf("WriteResultJSON: %s", err.Error())
+    }
+    g, err := ParseJSON(&out)
+    if err != nil {
+        t.Fatalf("ParseJSON: %s", err.Error())
+    }
+    reread, err := Run(g, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if got, want := CliqueKeys(reread.Cliques), CliqueKeys(result.Cliques); reflect.DeepEqual(got, want) == false {
+        t.Errorf("cliques %q, want %q", got, want)
+    }
+    got, want := communityStrings(reread.Communities), communityStrings(result.Communities)
+    if reflect.DeepEqual(got, want) == false {
+        t.Errorf("communities %q, want %q", got, want)
+    }
+}
+
+func TestParseJSONResult(t *testing.T) {
+    doc := `{"graph": {"nodes": ["a", "b", "c"], "edges": [["a", "b"], ["b", "c"]]}}`
+    parsed, err := ParseJSONResult(strings.NewReader(doc))
+    if err != nil {
+        t.Fatalf("ParseJSONResult: %s", err.Error())
+    }
+    if len(parsed.Graph) != 3 || parsed.Unweighted != 2 {
+        t.Errorf("%d vertices, %d unweighted edges; want 3 and 2", len(parsed.Graph), parsed.Unweighted)
+    }
+}
+
+func TestTopCommunities(t *testing.T) {
+    result := runModel(t)
+    result.Options.TopCommunities = 2
+    var out bytes.Buffer
+    if err := WriteResult(&out, "text", result); err != nil {
+        t.Fatalf("WriteResult: %s", err.Error())
+    }
+    _, top, found := strings.Cut(out.String(), "Largest communities:\n--------------------\n")
+    if found == false {
+        t.Fatalf("no largest communities in\n%s", out.String())
+    }
+    lines := strings.Split(strings.TrimSuffix(top, "\n"), "\n")
+    if len(lines) != 3 || lines[2] != "(1 more communities omitted)" {
+        t.Fatalf("got\n%s\nwant 2 communities and 1 omitted", top)
+    }
+    if strings.HasPrefix(lines[0], "Community 3: ") == false {
+        t.Errorf("%q: want the largest, community 3, first", lines[0])
+    }
+}
+
+func TestWeightQuantiles(t *testing.T) {
+    g, err := ParseWeightedCSV(strings.NewReader("a,b,1\nb,c,2\nc,d,3\nd,e,4\ne,f,5\n"))
+    if err != nil {
+        t.Fatalf("ParseWeightedCSV: %s", err.Error())
+    }
+    if got := WeightQuantiles(g); reflect.DeepEqual(got, []float64{1, 2, 3, 4, 5}) == false {
+        t.Errorf("quantiles %v, want [1 2 3 4 5]", got)
+    }
+    g, _ = ParseWeightedCSV(strings.NewReader("a,b,1\nb,c,2\n"))
+    if got := WeightQuantiles(g); reflect.DeepEqual(got, []float64{1, 1.25, 1.5, 1.75, 2}) == false {
+        t.Errorf("interpolated quantiles %v, want [1 1.25 1.5 1.75 2]", got)
+    }
+    if got := WeightQuantiles(completeGraph(1)); got != nil {
+        t.Errorf("no edges: quantiles %v, want nil", got)
+    }
+}
+
+func TestLargestComponent(t *testing.T) {
+    g, err := ParseGraph(strings.NewReader(MODEL_GRAPH + "x: y z\ny: x z\nz: x y\n"))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    component := LargestComponent(g.Nodes)
+    if len(component) != 10 || GetNode(component, "x") != nil {
+        t.Fatalf("largest component %q, want the Model Graph", NodeLabels(component))
+    }
+    result, err := Run(component, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, MODEL_COMMUNITIES) == false {
+        t.Errorf("communities %q, want %q", got, MODEL_COMMUNITIES)
+    }
+}
+
+func TestParseWarnings(t *testing.T) {
+    def := "# comment\nv1: v2 v2 v1 v3\nv2: v1\nv3: v1 v2\nv4:\n"
+    g, err := ParseGraph(strings.NewReader(def))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    want := []string{
+        "1 comment or blank lines skipped",
+        "v1: lists v2 more than once",
+        "v1: lists itself as a neighbor",
+        "v3: lists v2, but v2 doesn't list v3",
+        "removed 1 repeated neighbors",
+        "dropped the self-loops of 1 vertices",
+        "added the reverse of 1 edges listed by only one endpoint",
+    }
+    if reflect.DeepEqual(g.Warnings, want) == false {
+        t.Errorf("warnings\n%q\nwant\n%q", g.Warnings, want)
+    }
+    if g, _ := ParseGraph(strings.NewReader(MODEL_GRAPH)); len(g.Warnings) != 0 {
+        t.Errorf("Model Graph: warnings %q", g.Warnings)
+    }
+}
+
+func TestTransitivity(t *testing.T) {
+    // a triangle with a pendant vertex: 1 triangle and 1 + 1 + 3
+    // connected triples centered on a, b and c, so 3*1/5
+    g, _ := NewGraphBuilder().Node("a", "b", "c").Node("b", "c").Node("c", "d").Build()
+    triangles, triples, transitivity := Transitivity(g)
+    if triangles != 1 || triples != 5 || math.Abs(transitivity - 0.6) > 1e-9 {
+        t.Errorf("%d triangles, %d triples, transitivity %g, want 1, 5 and 0.6",
+            triangles, triples, transitivity)
+    }
+    if _, _, transitivity := Transitivity(completeGraph(5)); transitivity != 1 {
+        t.Errorf("complete graph: transitivity %g, want 1", transitivity)
+    }
+}
+
+// tarShards returns a tar archive holding the given files.
+func tarShards(t *testing.T, files map[string]string, names ...string) *bytes.Buffer {
+    var archive bytes.Buffer
+    writer := tar.NewWriter(&archive)
+    for _, name := range names {
+        header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name]))}
+        if err := writer.WriteHeader(header); err != nil {
+            t.Fatalf("%s", err.Error())
+        }
+        writer.Write([]byte(files[name]))
+    }
+    if err := writer.Close(); err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    return &archive
+}
+
+func TestParseTar(t *testing.T) {
+    files := map[string]string{
+        "a.txt": "v1: v2 v3\nv2: v1 v3\nv3: v1 v2\n",
+        "b.txt": "v3: v4 v5\nv4: v3 v5\nv5: v3 v4\n",
+    }
+    archive := tarShards(t, files, "a.txt", "b.txt")
+    var zipped bytes.Buffer
+    gz := gzip.NewWriter(&zipped)
+    gz.Write(archive.Bytes())
+    gz.Close()
+
+    for name, r := range map[string]io.Reader{"tar": bytes.NewReader(archive.Bytes()),
+        "tar.gz": &zipped} {
+        parsed, err := ParseTar(r, ParseOptions{})
+        if err != nil {
+            t.Fatalf("%s: ParseTar: %s", name, err.Error())
+        }
+        if len(parsed.Graph) != 5 {
+            t.Errorf("%s: nodes %q, want v1 to v5", name, NodeLabels(parsed.Graph))
+        }
+        want := []string{"v1 v2 v3", "v3 v4 v5"}
+        if got := CliqueKeys(FindKCliques(parsed.Graph, 3)); reflect.DeepEqual(got, want) == false {
+            t.Errorf("%s: cliques %q, want %q", name, got, want)
+        }
+    }
+
+    files["c.txt"] = "v1: v9\n"
+    _, err := ParseTar(tarShards(t, files, "a.txt", "c.txt"), ParseOptions{})
+    if err == nil || strings.HasPrefix(err.Error(), "c.txt: ") == false {
+        t.Errorf("error %v, want one naming c.txt", err)
+    }
+}
+
+func TestWriteCliquesBySize(t *testing.T) {
+    dir := t.TempDir()
+    g := modelGraph(t).Nodes
+    if err := WriteCliquesBySize(dir, g, 3); err != nil {
+        t.Fatalf("WriteCliquesBySize: %s", err.Error())
+    }
+    files, _ := filepath.Glob(filepath.Join(dir, "*"))
+    if len(files) != 2 {
+        t.Fatalf("files %q, want cliques-3.txt and cliques-4.txt", files)
+    }
+    for k := 3; k <= 4; k++ {
+        data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("cliques-%d.txt", k)))
+        if err != nil {
+            t.Fatalf("%s", err.Error())
+        }
+        var got []string
+        for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+            _, labels, _ := strings.Cut(line, ": ")
+            fields := strings.Fields(labels)
+            sort.Strings(fields)
+            got = append(got, strings.Join(fields, " "))
+        }
+        sort.Strings(got)
+        if want := CliqueKeys(FindKCliques(g, k)); reflect.DeepEqual(got, want) == false {
+            t.Errorf("cliques-%d.txt: %q, want %q", k, got, want)
+        }
+    }
+}
+
+func TestCheckNeighborCounts(t *testing.T) {
+    if _, err := ParseGraph(strings.NewReader("v1: v2 v2 v2\nv2: v1\n")); err != nil {
+        t.Errorf("repeated neighbor refused: %s", err.Error())
+    }
+    // v5 has 4 distinct neighbors, none of them in the 2 vertex graph
+    g := modelGraph(t).Nodes
+    cut := []*GraphNode{GetNode(g, "v5"), GetNode(g, "v1")}
+    err := CheckNeighborCounts(cut)
+    if err == nil || strings.Contains(err.Error(), "v5: has 4 distinct neighbors, but the graph has only 2 vertices") == false {
+        t.Errorf("error %v, want v5's neighbors refused", err)
+    }
+    if err := CheckNeighborCounts(g); err != nil {
+        t.Errorf("Model Graph: %s", err.Error())
+    }
+}
+
+func TestMergeIsolated(t *testing.T) {
+    // v11 has two neighbors in {v3, ..., v8} and one in {v8, v9, v10}
+    g, err := ParseGraph(strings.NewReader(MODEL_GRAPH + "v11: v4 v5 v9\n"))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    result, err := Run(g.Nodes, NewOptions(WithMergeIsolated(true)))
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    want := []string{"v1 v2 v3", "v10 v8 v9", "v11 v3 v4 v5 v6 v7 v8"}
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, want) == false {
+        t.Errorf("communities %q, want %q", got, want)
+    }
+    if len(result.Uncovered) != 0 {
+        t.Errorf("uncovered %q", NodeLabels(result.Uncovered))
+    }
+}
+
+func TestFingerprint(t *testing.T) {
+    first := Fingerprint(runModel(t))
+    if second := Fingerprint(runModel(t)); second != first {
+        t.Errorf("two runs: fingerprints %s and %s", first, second)
+    }
+    g := modelGraph(t).Nodes
+    AddEdge(GetNode(g, "v1"), GetNode(g, "v4"))
+    result, err := Run(g, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if changed := Fingerprint(result); changed == first {
+        t.Errorf("adding v1-v4 left the fingerprint %s", first)
+    }
+}
+
+func TestWriteNDJSON(t *testing.T) {
+    var out bytes.Buffer
+    if err := WriteNDJSON(&out, runModel(t)); err != nil {
+        t.Fatalf("WriteNDJSON: %s", err.Error())
+    }
+    counts := make(map[string]int)
+    var communities [][]*GraphNode
+    for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+        var record NDJSONRecord
+        if err := json.Unmarshal([]byte(line), &record); err != nil {
+            t.Fatalf("%q: %s", line, err.Error())
+        }
+        counts[record.Type]++
+        switch record.Type {
+        case "clique":
+            if len(record.Nodes) != 3 || record.CliqueID == "" {
+                t.Errorf("%q: want 3 nodes and a clique id", line)
+            }
+        case "community":
+            var community []*GraphNode
+            for _, label := range record.Nodes {
+                community = append(community, NewGraphNode(label, nil))
+            }
+            communities = append(communities, community)
+        case "summary":
+            if record.K != 3 || record.Stats == nil || record.Stats.Communities != 3 {
+                t.Errorf("%q: want k 3 and 3 communities", line)
+            }
+        }
+    }
+    want := map[string]int{"node": 10, "clique": 8, "community": 3, "summary": 1}
+    if reflect.DeepEqual(counts, want) == false {
+        t.Errorf("records %v, want %v", counts, want)
+    }
+    if got := communityStrings(communities); reflect.DeepEqual(got, MODEL_COMMUNITIES) == false {
+        t.Errorf("communities %q, want %q", got, MODEL_COMMUNITIES)
+    }
+}
+
+func TestExplainUncovered(t *testing.T) {
+    // d has degree 1; e, f, g and h form a square, with degree 2 but
+    // no triangle; the triangle x, y, z is rejected by the filter
+    def := "a: b c d\nb: a c\nc: a b\nd: a\n" +
+        "e: f h\nf: e g\ng: f h\nh: e g\n" +
+        "x: y z\ny: x z\nz: x y\n"
+    g, err := ParseGraph(strings.NewReader(def))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    without_x := func(nodes []*GraphNode) bool {
+        return GetNode(nodes, "x") == nil
+    }
+    result, err := Run(g.Nodes, NewOptions(WithAccept(without_x)))
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    var out bytes.Buffer
+    ExplainUncovered(&out, result)
+    want := "8 uncovered vertices:\n" +
+        "  d: degree 1 is below k-1 = 2\n" +
+        "  e: degree 2, but in no 3-clique\n" +
+        "  f: degree 2, but in no 3-clique\n" +
+        "  g: degree 2, but in no 3-clique\n" +
+        "  h: degree 2, but in no 3-clique\n" +
+        "  x: its 3-cliques were all rejected by the clique filter\n" +
+        "  y: its 3-cliques were all rejected by the clique filter\n" +
+        "  z: its 3-cliques were all rejected by the clique filter\n"
+    if out.String() != want {
+        t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+    }
+}
+
+func TestParseTGF(t *testing.T) {
+    file, err := os.Open("examples/model.tgf")
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    defer file.Close()
+    g, err := ParseTGF(file)
+    if err != nil {
+        t.Fatalf("ParseTGF: %s", err.Error())
+    }
+    got := CliqueKeys(FindKCliques(g, 3))
+    if want := CliqueKeys(FindKCliques(modelGraph(t).Nodes, 3)); reflect.DeepEqual(got, want) == false {
+        t.Errorf("cliques %q, want %q", got, want)
+    }
+}
+
+func TestGraphBuilder(t *testing.T) {
+    g, err := NewGraphBuilder().Strict().
+        Node("v1", "v2", "v3", "v2").Node("v2", "v3").Node("v3").Build()
+    if err != nil {
+        t.Fatalf("Build: %s", err.Error())
+    }
+    var out bytes.Buffer
+    FprintGraph(&out, g)
+    if want := "v1:  v2 v3 \nv2:  v1 v3 \nv3:  v1 v2 \n"; out.String() != want {
+        t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+    }
+
+    _, err = NewGraphBuilder().Strict().Node("v1", "v2").Build()
+    if err == nil || err.Error() != "v2: doesn't exist" {
+        t.Errorf("error %v, want v2 refused", err)
+    }
+    g, err = NewGraphBuilder().Node("v1", "v2").Build()
+    if err != nil || len(g) != 2 || GetNode(g, "v2").IsConnected(GetNode(g, "v1")) == false {
+        t.Errorf("non-strict: nodes %q, error %v, want v2 created", NodeLabels(g), err)
+    }
+    g, _ = NewGraphBuilder().Directed().Node("v1", "v2").Node("v2").Build()
+    if IsUndirected(g) {
+        t.Errorf("directed: the edge was added both ways")
+    }
+}
+
+func TestBridges(t *testing.T) {
+    result := runModel(t)
+    bridges := Bridges(result)
+    if len(bridges) != 2 || bridges[0].Label != "v3" || bridges[1].Label != "v8" {
+        t.Fatalf("bridges %+v, want v3 and v8", bridges)
+    }
+    for _, bridge := range bridges {
+        if bridge.Pairs != 1 || len(bridge.Communities) != 2 {
+            t.Errorf("%s: %d pairs of communities %v, want 1 pair", bridge.Label, bridge.Pairs,
+                bridge.Communities)
+        }
+    }
+
+    // a vertex in 3 triangles that share only it bridges 3 pairs
+    g, _ := NewGraphBuilder().Node("hub", "a", "b", "c", "d", "e", "f").
+        Node("a", "b").Node("c", "d").Node("e", "f").Build()
+    result, err := Run(g, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if bridges := Bridges(result); len(bridges) != 1 || bridges[0].Pairs != 3 {
+        t.Errorf("bridges %+v, want the hub bridging 3 pairs", bridges)
+    }
+}
+
+func TestFprintMembership(t *testing.T) {
+    result := runModel(t)
+    var out bytes.Buffer
+    FprintMembership(&out, result)
+    lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+    if len(lines) != 10 {
+        t.Fatalf("%d lines, want one per vertex", len(lines))
+    }
+    for _, line := range lines {
+        label, ids, _ := strings.Cut(line, ":")
+        want := ""
+        for _, id := range result.Membership[label] {
+            want += fmt.Sprintf(" %d", id)
+        }
+        if ids != want {
+            t.Errorf("%q: want %q", line, label + ":" + want)
+        }
+        if label == "v3" && len(strings.Fields(ids)) != 2 {
+            t.Errorf("%q: want 2 community ids", line)
+        }
+    }
+}
+
+func TestMixedK(t *testing.T) {
+    // the 4-clique a, b, c, d shares c and d with the triangle c, d, e,
+    // which shares only e with the triangle e, f, g
+    g, _ := NewGraphBuilder().Node("a", "b", "c", "d").Node("b", "c", "d").Node("c", "d", "e").
+        Node("d", "e").Node("e", "f", "g").Node("f", "g").Build()
+    result, err := Run(g, NewOptions(WithMixedK(3, 4)))
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if result.K != 3 {
+        t.Errorf("K %d, want the smallest size, 3", result.K)
+    }
+    want := []string{"a b c d e", "e f g"}
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, want) == false {
+        t.Errorf("communities %q, want %q", got, want)
+    }
+    // clique labels list the vertices in the order they were found
+    clique := func(labels string) *GraphNode {
+        for _, node := range result.CommunityGraph {
+            members := strings.Split(node.Label(), ",")
+            sort.Strings(members)
+            if strings.Join(members, ",") == labels {
+                return node
+            }
+        }
+        return nil
+    }
+    four := clique("a,b,c,d")
+    three := clique("c,d,e")
+    if four == nil || three == nil || four.IsConnected(three) == false {
+        t.Errorf("the 4-clique and the triangle sharing 2 vertices aren't connected")
+    }
+
+    result, err = Run(g, NewOptions(WithK(4)))
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, []string{"a b c d"}) == false {
+        t.Errorf("k=4: communities %q, want only a b c d", got)
+    }
+}
+
+func TestGobRoundTrip(t *testing.T) {
+    g, err := ParseWeightedCSV(strings.NewReader("a,b,0.5\nb,c,2\na,c\nc,d,1.5\n"))
+    if err != nil {
+        t.Fatalf("ParseWeightedCSV: %s", err.Error())
+    }
+    path := filepath.Join(t.TempDir(), "graph.gob")
+    if err := SaveGob(path, g); err != nil {
+        t.Fatalf("SaveGob: %s", err.Error())
+    }
+    loaded, err := LoadGob(path)
+    if err != nil {
+        t.Fatalf("LoadGob: %s", err.Error())
+    }
+    var before, after bytes.Buffer
+    FprintWeightedGraph(&before, g, true)
+    FprintWeightedGraph(&after, loaded, true)
+    if after.String() != before.String() {
+        t.Errorf("loaded\n%s\nwant\n%s", after.String(), before.String())
+    }
+    if IsUndirected(loaded) == false {
+        t.Errorf("loaded graph lost the reverse of some edges")
+    }
+}
+
+func TestWriteHighlightedDOT(t *testing.T) {
+    var out bytes.Buffer
+    WriteHighlightedDOT(&out, modelGraph(t).Nodes, map[string]bool{"v5": true, "v9": true})
+    var highlighted []string
+    for _, line := range strings.Split(out.String(), "\n") {
+        if strings.Contains(line, HIGHLIGHT_DOT_ATTRS) {
+            highlighted = append(highlighted, strings.TrimSpace(line))
+        }
+    }
+    want := []string{`"v5" [` + HIGHLIGHT_DOT_ATTRS + "];", `"v9" [` + HIGHLIGHT_DOT_ATTRS + "];"}
+    if reflect.DeepEqual(highlighted, want) == false {
+        t.Errorf("highlighted %q, want %q", highlighted, want)
+    }
+}
+
+func TestCompleteGraph(t *testing.T) {
+    g := completeGraph(8)
+    if IsComplete(g) == false {
+        t.Fatalf("complete graph of 8 vertices not recognized")
+    }
+    result, err := Run(g, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    want := []string{"n0 n1 n2 n3 n4 n5 n6 n7"}
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, want) == false {
+        t.Errorf("communities %q, want %q", got, want)
+    }
+    if len(result.Warnings) != 1 || strings.HasPrefix(result.Warnings[0], "complete graph of 8 vertices") == false {
+        t.Errorf("warnings %q, want the complete graph noted", result.Warnings)
+    }
+    if result.CliquesSkipped == false || result.Cliques != nil || result.Stats.Cliques != 56 {
+        t.Errorf("skipped %v, %d cliques found, %d counted; want skipped and C(8, 3) = 56 counted",
+            result.CliquesSkipped, CountCliques(result.Cliques), result.Stats.Cliques)
+    }
+    if err := ExplainCommunity(io.Discard, result, 1); err == nil {
+        t.Errorf("ExplainCommunity: no error without cliques")
+    }
+    var out bytes.Buffer
+    if err := WriteResultJSON(&out, result); err != nil {
+        t.Fatalf("WriteResultJSON: %s", err.Error())
+    }
+    if strings.Contains(out.String(), `"cliques_skipped": true`) == false {
+        t.Errorf("JSON doesn't mark the cliques skipped:\n%s", out.String())
+    }
+    if IsComplete(modelGraph(t).Nodes) {
+        t.Errorf("Model Graph taken for a complete graph")
+    }
+}
+
+func TestLargeCompleteGraph(t *testing.T) {
+    // K_40 has C(40, 6) = 3838380 6-cliques; enumerating them would
+    // take minutes, so finishing at all shows the search was skipped
+    done := make(chan *CPMResult)
+    go func() {
+        result, err := Run(completeGraph(40), NewOptions(WithK(6)))
+        if err != nil {
+            t.Errorf("Run: %s", err.Error())
+        }
+        done <- result
+    }()
+    select {
+    case result := <-done:
+        if result != nil && (len(result.Communities) != 1 || result.Stats.Cliques != 3838380) {
+            t.Errorf("%d communities, %d cliques; want 1 and 3838380",
+                len(result.Communities), result.Stats.Cliques)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatalf("K_40, k=6 not done after 5s: the cliques are being enumerated")
+    }
+}
+
+func TestBinomial(t *testing.T) {
+    for _, c := range []struct{ n, k, want int }{
+        {8, 3, 56}, {40, 6, 3838380}, {5, 0, 1}, {5, 6, 0}, {200, 100, math.MaxInt64},
+    } {
+        if got := Binomial(c.n, c.k); got != c.want {
+            t.Errorf("Binomial(%d, %d) = %d, want %d", c.n, c.k, got, c.want)
+        }
+    }
+}
+
+func TestMinOverlap(t *testing.T) {
+    // triangles sharing a single vertex percolate too, so the three
+    // communities join up through v3 and v8
+    result := runModel(t, WithMinOverlap(1))
+    want := []string{"v1 v10 v2 v3 v4 v5 v6 v7 v8 v9"}
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, want) == false {
+        t.Errorf("communities %q, want %q", got, want)
+    }
+    if got := communityStrings(runModel(t, WithMinOverlap(2)).Communities); reflect.DeepEqual(got, MODEL_COMMUNITIES) == false {
+        t.Errorf("min-overlap k-1: communities %q, want %q", got, MODEL_COMMUNITIES)
+    }
+
+    for _, fixture := range []struct {
+        options []Option
+        want string
+    }{
+        {[]Option{WithMinOverlap(-1)}, "min-overlap=-1: must be between 1 and k-1 = 2"},
+        {[]Option{WithMinOverlap(3)}, "min-overlap=3: must be between 1 and k-1 = 2"},
+        {[]Option{WithK(2), WithMinOverlap(2)}, "min-overlap=2: must be between 1 and k-1 = 1"},
+        {[]Option{WithMixedK(3, 4), WithMinOverlap(1)}, "min-overlap can't be used with mixed k"},
+    } {
+        _, err := Run(modelGraph(t).Nodes, NewOptions(fixture.options...))
+        if err == nil || err.Error() != fixture.want {
+            t.Errorf("error %v, want %q", err, fixture.want)
+        }
+    }
+}
+
+func TestOptions(t *testing.T) {
+    opts := NewOptions(WithK(4), WithWeightThreshold(0.5), WithJobs(8), WithRepeatable(true))
+    if opts.K != 4 || opts.WeightThreshold != 0.5 || opts.Accept == nil || opts.Jobs != 8 ||
+        opts.Repeatable == false {
+        t.Fatalf("options %+v", opts)
+    }
+    if opts := NewOptions(); opts.K != 3 || opts.Accept != nil {
+        t.Errorf("default options %+v, want k 3 and no filter", opts)
+    }
+
+    result, err := Run(modelGraph(t).Nodes, NewOptions(WithK(4), WithJobs(8)))
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, []string{"v4 v5 v6 v7"}) == false {
+        t.Errorf("k=4: communities %q, want v4 v5 v6 v7", got)
+    }
+}
+
+func TestLabelCollision(t *testing.T) {
+    // both triangles are labelled "a,b,c,x" by CreateLabel
+    g, _ := NewGraphBuilder().Node("a,b", "c", "x").Node("c", "x").
+        Node("a", "b,c", "x").Node("b,c", "x").Build()
+    result, err := Run(g, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if len(result.CommunityGraph) != 2 {
+        t.Fatalf("%d community graph nodes, want one per triangle", len(result.CommunityGraph))
+    }
+    labels := NodeLabels(result.CommunityGraph)
+    if labels[0] == labels[1] {
+        t.Errorf("both cliques labelled %q", labels[0])
+    }
+    if len(result.Communities) != 2 {
+        t.Errorf("%d communities, want the triangles kept apart", len(result.Communities))
+    }
+}
+
+func TestCommunityDensity(t *testing.T) {
+    g := modelGraph(t).Nodes
+    community := func(labels ...string) []*GraphNode {
+        var nodes []*GraphNode
+        for _, label := range labels {
+            nodes = append(nodes, GetNode(g, label))
+        }
+        return nodes
+    }
+    // a triangle, and 10 of the 15 possible edges among v3 to v8
+    if density := CommunityDensity(g, community("v1", "v2", "v3")); density != 1 {
+        t.Errorf("v1 v2 v3: density %g, want 1", density)
+    }
+    density := CommunityDensity(g, community("v3", "v4", "v5", "v6", "v7", "v8"))
+    if math.Abs(density - 2.0 / 3.0) > 1e-9 {
+        t.Errorf("v3 to v8: density %g, want 2/3", density)
+    }
+}
+
+func TestCanonicalize(t *testing.T) {
+    messy := "# a comment\nv2:  v3 v1 v1\n\nv1: v2 # trailing\nv3: v2 v1\n"
+    var once, twice bytes.Buffer
+    if err := Canonicalize(strings.NewReader(messy), &once); err != nil {
+        t.Fatalf("Canonicalize: %s", err.Error())
+    }
+    if strings.HasPrefix(once.String(), "# a comment\n") == false ||
+        strings.Contains(once.String(), "# trailing") == false {
+        t.Errorf("comments lost:\n%s", once.String())
+    }
+    if err := Canonicalize(strings.NewReader(once.String()), &twice); err != nil {
+        t.Fatalf("Canonicalize: %s", err.Error())
+    }
+    if twice.String() != once.String() {
+        t.Errorf("canonical file changed:\n%s\nbecame\n%s", once.String(), twice.String())
+    }
+
+    path := filepath.Join(t.TempDir(), "model.txt")
+    os.WriteFile(path, []byte(MODEL_GRAPH), 0644)
+    if err := CanonicalizeFile(path); err != nil {
+        t.Fatalf("CanonicalizeFile: %s", err.Error())
+    }
+    first, _ := os.ReadFile(path)
+    CanonicalizeFile(path)
+    if second, _ := os.ReadFile(path); bytes.Equal(first, second) == false {
+        t.Errorf("canonical file changed:\n%s\nbecame\n%s", first, second)
+    }
+}
+
+func TestGirvanNewman(t *testing.T) {
+    // two 4-cliques joined by the edge a4 - b1
+    builder := NewGraphBuilder()
+    for _, side := range []string{"a", "b"} {
+        for i := 1; i <= 4; i++ {
+            var neighbors []string
+            for j := i + 1; j <= 4; j++ {
+                neighbors = append(neighbors, fmt.Sprintf("%s%d", side, j))
+            }
+            builder.Node(fmt.Sprintf("%s%d", side, i), neighbors...)
+        }
+    }
+    g, _ := builder.Node("a4", "b1").Build()
+    want := []string{"a1 a2 a3 a4", "b1 b2 b3 b4"}
+    if got := communityStrings(GirvanNewman(g, 2)); reflect.DeepEqual(got, want) == false {
+        t.Errorf("Girvan-Newman: %q, want %q", got, want)
+    }
+    result, err := Run(g, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, want) == false {
+        t.Errorf("CPM: %q, want %q", got, want)
+    }
+}
+
+// sampleKeys returns the sorted keys of sampled cliques, like CliqueKeys.
+func sampleKeys(sample [][]*GraphNode) []string {
+    var keys []string
+    for _, nodes := range sample {
+        labels := NodeLabels(nodes)
+        sort.Strings(labels)
+        keys = append(keys, strings.Join(labels, " "))
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func TestSampleCliques(t *testing.T) {
+    g := modelGraph(t).Nodes
+    all := CliqueKeys(FindKCliques(g, 3))
+    for _, n := range []int{8, 100} {
+        if got := sampleKeys(SampleCliques(g, 3, n, 1)); reflect.DeepEqual(got, all) == false {
+            t.Errorf("n=%d: sample %q, want all %q", n, got, all)
+        }
+    }
+    first := sampleKeys(SampleCliques(g, 3, 3, 7))
+    if len(first) != 3 {
+        t.Fatalf("n=3: %d cliques", len(first))
+    }
+    if again := sampleKeys(SampleCliques(g, 3, 3, 7)); reflect.DeepEqual(again, first) == false {
+        t.Errorf("same seed: %q, then %q", first, again)
+    }
+}
+
+func TestValidateKRange(t *testing.T) {
+    // k=3 gives 3 communities, k=4 one and k=5 none
+    g := modelGraph(t).Nodes
+    best, scores, err := ValidateKRange(g, NewOptions(), 3, 5, "count")
+    if err != nil {
+        t.Fatalf("ValidateKRange: %s", err.Error())
+    }
+    want := []KScore{{K: 3, Communities: 3, Score: 3}, {K: 4, Communities: 1, Score: 1},
+        {K: 5, Communities: 0, Score: 0}}
+    if best != 3 || reflect.DeepEqual(scores, want) == false {
+        t.Errorf("best k %d, scores %+v, want 3 and %+v", best, scores, want)
+    }
+    if _, _, err := ValidateKRange(g, NewOptions(), 3, 5, "size"); err == nil {
+        t.Errorf("unknown criterion accepted")
+    }
+}
+
+func TestMixedFormatShards(t *testing.T) {
+    // GraphML isn't an input format; a colon shard and a csv shard are
+    // merged instead
+    dir := t.TempDir()
+    colon := filepath.Join(dir, "a.txt")
+    os.WriteFile(colon, []byte("v1: v2 v3\nv2: v1 v3\nv3: v1 v2\n"), 0644)
+    edges := filepath.Join(dir, "b.edges")
+    os.WriteFile(edges, []byte("v3,v4\nv4,v5\nv3,v5\n"), 0644)
+
+    var shards [][]*GraphNode
+    for _, arg := range []string{colon, edges + ":csv"} {
+        filename, informat, err := SplitFormatSuffix(arg, "colon")
+        if err != nil {
+            t.Fatalf("SplitFormatSuffix: %s", err.Error())
+        }
+        parsed, err := ParseGraphFile(filename, informat, ParseOptions{})
+        if err != nil {
+            t.Fatalf("%s: %s", arg, err.Error())
+        }
+        shards = append(shards, parsed.Graph)
+    }
+    want := []string{"v1 v2 v3", "v3 v4 v5"}
+    if got := CliqueKeys(FindKCliques(MergeGraphs(shards...), 3)); reflect.DeepEqual(got, want) == false {
+        t.Errorf("cliques %q, want %q", got, want)
+    }
+
+    _, _, err := SplitFormatSuffix(edges + ":graphml", "colon")
+    if err == nil || strings.Contains(err.Error(), `unknown input format suffix "graphml"`) == false {
+        t.Errorf("error %v, want the graphml suffix refused", err)
+    }
+}
+
+func TestPruneLeaves(t *testing.T) {
+    // v11 and v12 hang off v1 as a path
+    g, err := ParseGraph(strings.NewReader(MODEL_GRAPH + "v11: v1 v12\nv12: v11\n"))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    pruned, removed := PruneLeaves(g.Nodes)
+    if removed != 2 || len(pruned) != 10 {
+        t.Errorf("%d vertices removed, %d left, want 2 and 10", removed, len(pruned))
+    }
+    before, err := Run(g.Nodes, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    after, err := Run(pruned, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if reflect.DeepEqual(communityStrings(after.Communities), communityStrings(before.Communities)) == false {
+        t.Errorf("communities %q after pruning, %q before", communityStrings(after.Communities),
+            communityStrings(before.Communities))
+    }
+    if len(g.Nodes) != 12 {
+        t.Errorf("original graph changed to %d vertices", len(g.Nodes))
+    }
+}
+
+func TestWriteNMICommunities(t *testing.T) {
+    result := runModel(t)
+    var out bytes.Buffer
+    WriteNMICommunities(&out, result)
+    labels := make(map[int]*GraphNode)
+    for node, id := range IndexMap(result.Graph) {
+        labels[id] = node
+    }
+    var communities [][]*GraphNode
+    for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+        var community []*GraphNode
+        previous := 0
+        for _, field := range strings.Split(line, " ") {
+            id, err := strconv.Atoi(field)
+            if err != nil || labels[id] == nil || id <= previous {
+                t.Fatalf("%q: %q isn't an ascending vertex id", line, field)
+            }
+            previous = id
+            community = append(community, labels[id])
+        }
+        communities = append(communities, community)
+    }
+    if got := communityStrings(communities); reflect.DeepEqual(got, MODEL_COMMUNITIES) == false {
+        t.Errorf("communities %q, want %q", got, MODEL_COMMUNITIES)
+    }
+}
+
+func TestHasCommunity(t *testing.T) {
+    if HasCommunity(modelGraph(t).Nodes, 3, nil) == false {
+        t.Errorf("Model Graph: no community found")
+    }
+    // two triangles sharing only c: they don't percolate, but each is
+    // a community of its own
+    g, _ := NewGraphBuilder().Node("a", "b", "c").Node("b", "c").Node("c", "d", "e").
+        Node("d", "e").Build()
+    if HasCommunity(g, 3, nil) == false {
+        t.Errorf("bowtie: no community found")
+    }
+    if HasCommunity(g, 4, nil) {
+        t.Errorf("bowtie, k=4: community found")
+    }
+    none := func(nodes []*GraphNode) bool { return false }
+    if HasCommunity(g, 3, none) {
+        t.Errorf("bowtie, every clique refused: community found")
+    }
+}
+
+func TestTranspose(t *testing.T) {
+    // a -> b -> c, and a -> c
+    g, _ := NewGraphBuilder().Directed().Node("a", "b", "c").Node("b", "c").Node("c").Build()
+    transposed := Transpose(g)
+    var out bytes.Buffer
+    FprintGraph(&out, transposed)
+    if want := "a:  \nb:  a \nc:  a b \n"; out.String() != want {
+        t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+    }
+    if GetNode(g, "b").IsConnected(GetNode(g, "a")) == false {
+        t.Errorf("original graph changed")
+    }
+}
+
+func TestCommunitiesHandler(t *testing.T) {
+    server := httptest.NewServer(CommunitiesHandler(NewOptions(), "colon", ParseOptions{}, 1 << 20))
+    defer server.Close()
+
+    for k, want := range map[string][]string{"3": MODEL_COMMUNITIES, "4": {"v4 v5 v6 v7"}} {
+        response, err := http.Post(server.URL + "?k=" + k, "text/plain", strings.NewReader(MODEL_GRAPH))
+        if err != nil {
+            t.Fatalf("POST: %s", err.Error())
+        }
+        var body CommunitiesResponse
+        err = json.NewDecoder(response.Body).Decode(&body)
+        response.Body.Close()
+        if err != nil {
+            t.Fatalf("k=%s: %s", k, err.Error())
+        }
+        var got []string
+        for _, community := range body.Communities {
+            sort.Strings(community)
+            got = append(got, strings.Join(community, " "))
+        }
+        sort.Strings(got)
+        if response.StatusCode != http.StatusOK || reflect.DeepEqual(got, want) == false {
+            t.Errorf("k=%s: status %d, communities %q, want %q", k, response.StatusCode, got, want)
+        }
+    }
+
+    response, err := http.Post(server.URL, "text/plain", strings.NewReader("v1: v9\n"))
+    if err != nil {
+        t.Fatalf("POST: %s", err.Error())
+    }
+    response.Body.Close()
+    if response.StatusCode != http.StatusBadRequest {
+        t.Errorf("bad graph: status %d, want 400", response.StatusCode)
+    }
+
+    small := httptest.NewServer(CommunitiesHandler(NewOptions(), "colon", ParseOptions{}, 16))
+    defer small.Close()
+    response, err = http.Post(small.URL, "text/plain", strings.NewReader(MODEL_GRAPH))
+    if err != nil {
+        t.Fatalf("POST: %s", err.Error())
+    }
+    response.Body.Close()
+    if response.StatusCode != http.StatusRequestEntityTooLarge {
+        t.Errorf("oversized body: status %d, want 413", response.StatusCode)
+    }
+}
+
+func TestCliqueIDs(t *testing.T) {
+    ids := func(result *CPMResult) map[string]string {
+        by_key := make(map[string]string)
+        for clique := result.Cliques; clique != nil; clique = clique.next {
+            labels := clique.Labels()
+            sort.Strings(labels)
+            by_key[strings.Join(labels, " ")] = clique.ID()
+        }
+        return by_key
+    }
+    first := ids(runModel(t))
+    used := make(map[string]bool)
+    valid := regexp.MustCompile(`^c[0-9a-f]{12}$`)
+    for key, id := range first {
+        if valid.MatchString(id) == false || used[id] {
+            t.Errorf("%s: id %q is malformed or repeated", key, id)
+        }
+        used[id] = true
+    }
+    // the same cliques found in another order keep their ids
+    g := modelGraph(t).Nodes
+    for i, j := 0, len(g) - 1; i < j; i, j = i + 1, j - 1 {
+        g[i], g[j] = g[j], g[i]
+    }
+    result, err := Run(g, NewOptions(WithAlgo("bk")))
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    if second := ids(result); len(first) != 8 || reflect.DeepEqual(second, first) == false {
+        t.Errorf("ids %v, then %v", first, second)
+    }
+}
+
+func TestParseNodesEdges(t *testing.T) {
+    nodes := "label,weight\n"
+    for i := 1; i <= 10; i++ {
+        nodes += fmt.Sprintf("v%d\n", i)
+    }
+    var edges string
+    for _, edge := range Edges(modelGraph(t).Nodes) {
+        edges += edge[0].Label() + "," + edge[1].Label() + "\n"
+    }
+    parsed, err := ParseNodesEdges(strings.NewReader(nodes), strings.NewReader(edges), false)
+    if err != nil {
+        t.Fatalf("ParseNodesEdges: %s", err.Error())
+    }
+    var got, want bytes.Buffer
+    FprintGraph(&got, parsed.Graph)
+    FprintGraph(&want, modelGraph(t).Nodes)
+    if got.String() != want.String() {
+        t.Errorf("got\n%s\nwant\n%s", got.String(), want.String())
+    }
+
+    edges += "v10,v11\n"
+    _, err = ParseNodesEdges(strings.NewReader(nodes), strings.NewReader(edges), false)
+    if err == nil || strings.Contains(err.Error(), "v11") == false {
+        t.Errorf("error %v, want v11 named", err)
+    }
+    parsed, err = ParseNodesEdges(strings.NewReader(nodes), strings.NewReader(edges), true)
+    if err != nil || len(parsed.Graph) != 11 {
+        t.Errorf("autocreate: error %v, want v11 added", err)
+    }
+}
+
+func TestTraceCliqueSearch(t *testing.T) {
+    g := modelGraph(t).Nodes
+    var out bytes.Buffer
+    TraceCliqueSearch(&out, GetNode(g, "v5"), 3, nil)
+    want := "v5: 6 candidates for k=3\n" +
+        "  v3,v7: rejected: v7 doesn't list v3\n" +
+        "  v6,v3: rejected: v3 doesn't list v6\n" +
+        "  v3,v4: accepted, clique v3,v4,v5\n" +
+        "  v6,v4: accepted, clique v6,v4,v5\n" +
+        "  v4,v7: accepted, clique v4,v7,v5\n" +
+        "  v6,v7: accepted, clique v6,v7,v5\n"
+    if out.String() != want {
+        t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+    }
+}
+
+func TestWriteOneHot(t *testing.T) {
+    result := runModel(t)
+    var out bytes.Buffer
+    if err := WriteOneHot(&out, result); err != nil {
+        t.Fatalf("WriteOneHot: %s", err.Error())
+    }
+    rows, err := csv.NewReader(&out).ReadAll()
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    if reflect.DeepEqual(rows[0], []string{"label", "1", "2", "3"}) == false {
+        t.Errorf("header %q", rows[0])
+    }
+    if len(rows) != 11 {
+        t.Fatalf("%d rows, want a header and one per vertex", len(rows))
+    }
+    for _, row := range rows[1:] {
+        var ids []int
+        for column, cell := range row[1:] {
+            if cell == "1" {
+                ids = append(ids, column + 1)
+            } else if cell != "0" {
+                t.Errorf("%s: cell %q", row[0], cell)
+            }
+        }
+        if reflect.DeepEqual(ids, result.Membership[row[0]]) == false {
+            t.Errorf("%s: communities %v, want %v", row[0], ids, result.Membership[row[0]])
+        }
+    }
+}
+
+func TestCandidateEstimate(t *testing.T) {
+    // the Model Graph's degrees are 2 and 4, so 4 * C(2, 2) + 6 * C(4, 2)
+    for _, g := range [][]*GraphNode{modelGraph(t).Nodes, completeGraph(6)} {
+        candidates := 0
+        for _, node := range g {
+            for item := GetCliqueCandidates(3, node.neighbors); item != nil; item = item.next {
+                candidates++
+            }
+        }
+        if estimate := CandidateEstimate(g, 3); estimate < candidates {
+            t.Errorf("estimate %d below the %d candidates", estimate, candidates)
+        }
+    }
+    if estimate := CandidateEstimate(modelGraph(t).Nodes, 3); estimate != 40 {
+        t.Errorf("Model Graph: estimate %d, want 40", estimate)
+    }
+}
+
+func TestEgoSubgraph(t *testing.T) {
+    g := modelGraph(t).Nodes
+    ego := EgoSubgraph(g, GetNode(g, "v5"), 1)
+    if got := NodeLabels(ego); reflect.DeepEqual(got, []string{"v3", "v4", "v5", "v6", "v7"}) == false {
+        t.Fatalf("ego subgraph %q, want v5 and its neighbors", got)
+    }
+    result, err := Run(ego, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    want := []string{"v3 v4 v5 v6 v7"}
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, want) == false {
+        t.Errorf("communities %q, want %q", got, want)
+    }
+    if got := NodeLabels(EgoSubgraph(g, GetNode(g, "v5"), 0)); reflect.DeepEqual(got, []string{"v5"}) == false {
+        t.Errorf("radius 0: %q, want v5 alone", got)
+    }
+}
+
+func TestFprintCompact(t *testing.T) {
+    result := runModel(t, WithRepeatable(true))
+    var out bytes.Buffer
+    FprintCompact(&out, result)
+    want := "3 communities:\n" +
+        "Community 1: v1 v2 v3\n" +
+        "Community 2: v10 v8 v9\n" +
+        "Community 3: v3 v4 v5 v6 v7 v8\n"
+    if out.String() != want {
+        t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+    }
+
+    result.Options.TopCommunities = 1
+    out.Reset()
+    FprintCompact(&out, result)
+    want = "3 communities:\n" +
+        "Community 3: v3 v4 v5 v6 v7 v8\n" +
+        "(2 more communities omitted)\n"
+    if out.String() != want {
+        t.Errorf("-top-communities 1: got\n%s\nwant\n%s", out.String(), want)
+    }
+}
+
+func TestCheckCommunityGraph(t *testing.T) {
+    result := runModel(t)
+    if err := CheckCommunityGraph(result.CommunityGraph); err != nil {
+        t.Fatalf("Model Graph: %s", err.Error())
+    }
+    node := result.CommunityGraph[2]
+    node.associated_clique = nil
+    err := CheckCommunityGraph(result.CommunityGraph)
+    if err == nil || strings.Contains(err.Error(), node.label) == false {
+        t.Errorf("error %v, want %s named", err, node.label)
+    }
+}
+
+func TestCommunitiesParallel(t *testing.T) {
+    // the Model Graph, plus 20 separate triangles for the jobs to share
+    def := MODEL_GRAPH
+    for i := 0; i < 20; i++ {
+        def += fmt.Sprintf("a%d: b%d c%d\nb%d: a%d c%d\nc%d: a%d b%d\n", i, i, i, i, i, i, i, i, i)
+    }
+    g, err := ParseGraph(strings.NewReader(def))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    clique_list := FindKCliques(g.Nodes, 3)
+    labels := func(communities [][]*GraphNode) [][]string {
+        var all [][]string
+        for _, community := range communities {
+            all = append(all, NodeLabels(community))
+        }
+        return all
+    }
+    serial := labels(FindCommunities(CreateCommunityGraph(clique_list, 3)))
+    for _, jobs := range []int{2, 4, 8} {
+        community_graph := CreateCommunityGraphParallel(clique_list, 3, jobs)
+        if err := CheckCommunityGraph(community_graph); err != nil {
+            t.Fatalf("jobs=%d: %s", jobs, err.Error())
+        }
+        parallel := labels(FindCommunitiesParallel(community_graph, jobs))
+        if reflect.DeepEqual(parallel, serial) == false {
+            t.Errorf("jobs=%d: communities %q, serial %q", jobs, parallel, serial)
+        }
+    }
+}
+
+func TestRelabelGraph(t *testing.T) {
+    mapping, err := ReadLabelMap(strings.NewReader("v1\tann\nv2\tbob\n\nv3\tcy\n"))
+    if err != nil {
+        t.Fatalf("ReadLabelMap: %s", err.Error())
+    }
+    g := modelGraph(t).Nodes
+    if err := RelabelGraph(g, mapping); err != nil {
+        t.Fatalf("RelabelGraph: %s", err.Error())
+    }
+    result, err := Run(g, NewOptions())
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    want := []string{"ann bob cy", "cy v4 v5 v6 v7 v8", "v10 v8 v9"}
+    if got := communityStrings(result.Communities); reflect.DeepEqual(got, want) == false {
+        t.Errorf("communities %q, want %q", got, want)
+    }
+
+    if err := RelabelGraph(g, map[string]string{"ann": "v4"}); err == nil {
+        t.Errorf("collision with v4 accepted")
+    }
+    if GetNode(g, "ann") == nil {
+        t.Errorf("graph changed by the refused relabeling")
+    }
+    if _, err := ReadLabelMap(strings.NewReader("v1 ann\n")); err == nil {
+        t.Errorf("line without a tab accepted")
+    }
+}
+
+func TestWriteMarkdown(t *testing.T) {
+    // two triangles sharing the vertex "a|b"
+    g, _ := NewGraphBuilder().Node("a|b", "c", "d", "e", "f").Node("c", "d").Node("e", "f").Build()
+    result, err := Run(g, NewOptions(WithRepeatable(true)))
+    if err != nil {
+        t.Fatalf("Run: %s", err.Error())
+    }
+    var out bytes.Buffer
+    WriteMarkdown(&out, result)
+    // a table row has one more unescaped pipe than its table has columns
+    unescaped := regexp.MustCompile(`(^|[^\\])\|`)
+    columns := 0
+    for _, line := range strings.Split(out.String(), "\n") {
+        if strings.HasPrefix(line, "|") == false {
+            columns = 0
+            continue
+        }
+        pipes := len(unescaped.FindAllString(line, -1))
+        if columns == 0 {
+            columns = pipes
+        } else if pipes != columns {
+            t.Errorf("%q: %d pipes, the table's header has %d", line, pipes, columns)
+        }
+    }
+    for _, row := range []string{"| 3 | 5 | 6 | 2 | 2 |", `| a\|b | 1 2 |`, "|---|---|---|"} {
+        if strings.Contains(out.String(), row + "\n") == false {
+            t.Errorf("no %q row in\n%s", row, out.String())
+        }
+    }
+}
+
+func TestChooseAlgo(t *testing.T) {
+    sparse := modelGraph(t).Nodes
+    // 7 vertices with the n0-n1 edge missing, far denser than
+    // AUTO_BK_DENSITY
+    var dense []*GraphNode
+    for i := 0; i < 7; i++ {
+        dense = append(dense, NewGraphNode(fmt.Sprintf("n%d", i), nil))
+    }
+    for i := range dense {
+        for j := i + 1; j < len(dense); j++ {
+            if i > 0 || j > 1 {
+                AddEdge(dense[i], dense[j])
+            }
+        }
+    }
+    for _, fixture := range []struct {
+        g []*GraphNode
+        algo string
+    }{{sparse, "candidates"}, {dense, "bk"}} {
+        if algo := ChooseAlgo(fixture.g, NewOptions()); algo != fixture.algo {
+            t.Errorf("density %g: %s, want %s", Density(fixture.g), algo, fixture.algo)
+        }
+        auto, err := Run(fixture.g, NewOptions(WithAlgo("auto")))
+        if err != nil {
+            t.Fatalf("Run: %s", err.Error())
+        }
+        if auto.Algo != fixture.algo {
+            t.Errorf("auto ran %s, want %s", auto.Algo, fixture.algo)
+        }
+        for _, algo := range []string{"candidates", "bk"} {
+            forced, err := Run(fixture.g, NewOptions(WithAlgo(algo)))
+            if err != nil {
+                t.Fatalf("Run: %s", err.Error())
+            }
+            if reflect.DeepEqual(CliqueKeys(forced.Cliques), CliqueKeys(auto.Cliques)) == false ||
+                reflect.DeepEqual(communityStrings(forced.Communities),
+                    communityStrings(auto.Communities)) == false {
+                t.Errorf("%s and auto disagree", algo)
+            }
+        }
+    }
+    limited := NewOptions(WithLimits(Limits{MaxCliques: 100}))
+    if algo := ChooseAlgo(dense, limited); algo != "candidates" {
+        t.Errorf("with a clique limit: %s, want candidates", algo)
+    }
+
+    // the default output is the same whichever search auto picks
+    var outputs []string
+    for _, opts := range []Options{NewOptions(), limited} {
+        result, err := Run(dense, opts)
+        if err != nil {
+            t.Fatalf("Run: %s", err.Error())
+        }
+        var out bytes.Buffer
+        if err := WriteResult(&out, "text", result); err != nil {
+            t.Fatalf("WriteResult: %s", err.Error())
+        }
+        outputs = append(outputs, out.String())
+    }
+    if outputs[0] != outputs[1] {
+        t.Errorf("bk output\n%s\ndiffers from candidates output\n%s", outputs[0], outputs[1])
+    }
+}
+
+func TestCliqueStream(t *testing.T) {
+    stream := NewCliqueStream(3)
+    steps := []struct {
+        a, b string
+        want []string
+    }{
+        {"v1", "v2", nil},
+        {"v2", "v3", nil},
+        {"v1", "v3", []string{"v1 v2 v3"}},
+        {"v3", "v4", nil},
+        {"v2", "v4", []string{"v2 v3 v4"}},
+        {"v1", "v4", []string{"v1 v2 v4", "v1 v3 v4"}},
+        {"v1", "v4", nil},
+    }
+    for _, step := range steps {
+        got := sampleKeys(stream.AddEdge(step.a, step.b))
+        if reflect.DeepEqual(got, step.want) == false {
+            t.Errorf("%s-%s: cliques %q, want %q", step.a, step.b, got, step.want)
+        }
+    }
+}
+
+func TestSmallK(t *testing.T) {
+    g := modelGraph(t).Nodes
+    for _, opts := range []Options{NewOptions(WithK(1)), NewOptions(WithK(0)),
+        NewOptions(WithMixedK(1, 3))} {
+        _, err := Run(g, opts)
+        if err == nil || strings.HasSuffix(err.Error(), "cliques must have at least 2 vertices") == false {
+            t.Errorf("k=%d, mixed %v: error %v, want small k refused", opts.K, opts.MixedK, err)
+        }
+    }
+    if _, err := Run(g, NewOptions(WithK(2))); err != nil {
+        t.Errorf("k=2: %s", err.Error())
+    }
+}
+
+func TestWriteReport(t *testing.T) {
+    var out bytes.Buffer
+    WriteReport(&out, runModel(t))
+    report := out.String()
+    for _, section := range []string{"Graph\n-----\n", "Cliques\n-------\n",
+        "Communities\n-----------\n", "Overlap\n-------\n", "Quality\n-------\n"} {
+        if strings.Contains(report, section) == false {
+            t.Errorf("no %q section", strings.Split(section, "\n")[0])
+        }
+    }
+    for _, line := range []string{"vertices:     10", "k-cliques:    8", "    4: 1", "3 communities",
+        "v3: in 2 communities", "coverage:     1.0000"} {
+        if strings.Contains(report, line + "\n") == false {
+            t.Errorf("no %q line in\n%s", line, report)
+        }
+    }
+    if strings.Contains(report, "Community 3: 6 vertices, density 0.6667: ") == false {
+        t.Errorf("no density for the community of 6 vertices")
+    }
+}
+
+func TestFindCommunities(t *testing.T) {
+    g := modelGraph(t).Nodes
+    communities := FindCommunities(CreateCommunityGraph(FindKCliques(g, 3), 3))
+    if got := communityStrings(communities); reflect.DeepEqual(got, MODEL_COMMUNITIES) == false {
+        t.Errorf("communities %q, want %q", got, MODEL_COMMUNITIES)
+    }
+    // v3 and v8 are in two cliques of their community but listed once
+    for _, community := range communities {
+        seen := make(map[*GraphNode]bool)
+        for _, node := range community {
+            if seen[node] {
+                t.Errorf("%s listed twice in %q", node.label, NodeLabels(community))
+            }
+            seen[node] = true
+        }
+    }
+    path, _ := NewGraphBuilder().Node("a", "b").Node("b", "c").Build()
+    if communities := FindCommunities(CreateCommunityGraph(FindKCliques(path, 3), 3)); len(communities) != 0 {
+        t.Errorf("a path: communities %q", communityStrings(communities))
+    }
+}
+
+func TestDuplicateNode(t *testing.T) {
+    def := "v1: v2\nv2: v1 v3\nv3: v2\nv1: v3\n"
+    _, err := ParseGraph(strings.NewReader(def))
+    if err == nil || err.Error() != "line 4: duplicate node 'v1'" {
+        t.Errorf("error %v, want the second v1 refused", err)
+    }
+    result, err := ParseGraphDefReader(strings.NewReader(def), ParseOptions{MergeDuplicates: true})
+    if err != nil {
+        t.Fatalf("-merge-duplicates: %s", err.Error())
+    }
+    if len(result.Graph) != 3 || GetNode(result.Graph, "v1").Degree() != 2 {
+        t.Errorf("-merge-duplicates: nodes %q, want one v1 with both neighbors", NodeLabels(result.Graph))
+    }
+}
+
+func TestWriteDOT(t *testing.T) {
+    result := runModel(t)
+    var out bytes.Buffer
+    WriteDOT(&out, result.Graph)
+    dot := out.String()
+    if strings.HasPrefix(dot, "graph {\n") == false || strings.HasSuffix(dot, "}\n") == false {
+        t.Fatalf("not a DOT graph:\n%s", dot)
+    }
+    edges := make(map[string]bool)
+    for _, line := range strings.Split(dot, "\n") {
+        a, b, found := strings.Cut(strings.TrimSuffix(strings.TrimSpace(line), ";"), " -- ")
+        if found == false {
+            continue
+        }
+        if edges[a + b] || edges[b + a] {
+            t.Errorf("edge %s -- %s written twice", a, b)
+        }
+        edges[a + b] = true
+    }
+    if len(edges) != 16 {
+        t.Errorf("%d edges, want 16", len(edges))
+    }
+
+    out.Reset()
+    WriteCommunityGraphDOT(&out, result.CommunityGraph)
+    if clusters := strings.Count(out.String(), "subgraph cluster_"); clusters != 3 {
+        t.Errorf("%d clusters, want one per community", clusters)
+    }
+    // clique labels have commas, so they must be quoted
+    if regexp.MustCompile(`(?m)^\s+v\d+,`).MatchString(out.String()) {
+        t.Errorf("unquoted clique label in\n%s", out.String())
+    }
+}
+
+func TestResultJSON(t *testing.T) {
+    write := func(g []*GraphNode) ResultJSON {
+        result, err := Run(g, NewOptions())
+        if err != nil {
+            t.Fatalf("Run: %s", err.Error())
+        }
+        var out bytes.Buffer
+        if err := WriteResultJSON(&out, result); err != nil {
+            t.Fatalf("WriteResultJSON: %s", err.Error())
+        }
+        var doc ResultJSON
+        if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+            t.Fatalf("%s", err.Error())
+        }
+        return doc
+    }
+    doc := write(modelGraph(t).Nodes)
+    if doc.K != 3 || len(doc.Graph.Nodes) != 10 || len(doc.Graph.Edges) != 16 ||
+        len(doc.CommunityGraph.Nodes) != 8 || len(doc.Communities) != 3 {
+        t.Errorf("document %+v", doc)
+    }
+    if len(doc.Cliques) == 0 || reflect.DeepEqual(doc.Cliques[0], []string{"v1", "v2", "v3"}) == false {
+        t.Errorf("cliques %q, want v1 v2 v3 first", doc.Cliques)
+    }
+
+    // the clique list doesn't depend on the order the graph is in
+    reversed := modelGraph(t).Nodes
+    for i, j := 0, len(reversed) - 1; i < j; i, j = i + 1, j - 1 {
+        reversed[i], reversed[j] = reversed[j], reversed[i]
+    }
+    if cliques := write(reversed).Cliques; reflect.DeepEqual(cliques, doc.Cliques) == false {
+        t.Errorf("reversed graph: cliques %q, want %q", cliques, doc.Cliques)
+    }
+}
+
+func TestNodeIndex(t *testing.T) {
+    g := modelGraph(t).Nodes
+    index := IndexNodes(g)
+    for _, node := range g {
+        if index.Node(node.label) != node || GetNode(g, node.label) != node {
+            t.Errorf("%s: looked up the wrong node", node.label)
+        }
+    }
+    if index.Node("v11") != nil {
+        t.Errorf("v11 found")
+    }
+}
+
+// ringLattice returns a graph definition of n vertices, each joined to
+// the two vertices on either side of it.
+func ringLattice(n int) string {
+    var def strings.Builder
+    for i := 0; i < n; i++ {
+        fmt.Fprintf(&def, "v%d: v%d v%d v%d v%d\n", i, (i + n - 2) % n, (i + n - 1) % n,
+            (i + 1) % n, (i + 2) % n)
+    }
+    return def.String()
+}
+
+func BenchmarkParse50k(b *testing.B) {
+    def := ringLattice(50000)
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        g, err := ParseGraph(strings.NewReader(def))
+        if err != nil {
+            b.Fatalf("ParseGraph: %s", err.Error())
+        }
+        if len(g.Nodes) != 50000 {
+            b.Fatalf("%d nodes", len(g.Nodes))
+        }
+    }
+}
+
+func TestNeighborSet(t *testing.T) {
+    g := modelGraph(t).Nodes
+    AddEdge(GetNode(g, "v1"), GetNode(g, "v10"))
+    v4, v5 := GetNode(g, "v4"), GetNode(g, "v5")
+    FilterNeighbors(v4, func(neighbor *GraphNode) bool {
+        return neighbor != v5
+    })
+    FilterNeighbors(v5, func(neighbor *GraphNode) bool {
+        return neighbor != v4
+    })
+    FilterNeighbors(GetNode(g, "v8"), func(neighbor *GraphNode) bool {
+        return neighbor.label != "v9"
+    })
+    for _, a := range g {
+        listed := make(map[*GraphNode]bool)
+        for _, neighbor := range a.neighbors {
+            listed[neighbor] = true
+        }
+        for _, b := range g {
+            if b.IsConnected(a) != listed[b] {
+                t.Errorf("%s lists %s: %t, IsConnected says %t", a.label, b.label, listed[b],
+                    b.IsConnected(a))
+            }
+        }
+    }
+}
+
+func TestGraphAPI(t *testing.T) {
+    saved := os.Stdout
+    read, write, err := os.Pipe()
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    os.Stdout = write
+    g, err := ParseGraph(strings.NewReader(MODEL_GRAPH))
+    var cliques []*Clique
+    var communities [][]string
+    if err == nil {
+        cliques = g.Cliques(3)
+        communities, err = g.Communities(3)
+    }
+    os.Stdout = saved
+    write.Close()
+    printed, _ := io.ReadAll(read)
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    if len(printed) > 0 {
+        t.Errorf("printed %q", printed)
+    }
+
+    if len(cliques) != 8 {
+        t.Errorf("%d cliques, want 8", len(cliques))
+    }
+    var got []string
+    for _, community := range communities {
+        sort.Strings(community)
+        got = append(got, strings.Join(community, " "))
+    }
+    sort.Strings(got)
+    if reflect.DeepEqual(got, MODEL_COMMUNITIES) == false {
+        t.Errorf("communities %q, want %q", got, MODEL_COMMUNITIES)
+    }
+    if communities, err := g.Communities(5); err != nil || communities == nil || len(communities) != 0 {
+        t.Errorf("k=5: communities %q, error %v, want none", communities, err)
+    }
+}
+
+func TestStdin(t *testing.T) {
+    saved := os.Stdin
+    read, write, err := os.Pipe()
+    if err != nil {
+        t.Fatalf("%s", err.Error())
+    }
+    os.Stdin = read
+    defer func() {
+        os.Stdin = saved
+        read.Close()
+    }()
+    go func() {
+        write.WriteString(MODEL_GRAPH)
+        write.Close()
+    }()
+    g, err := ParseGraphDefFile("-")
+    if err != nil {
+        t.Fatalf("ParseGraphDefFile: %s", err.Error())
+    }
+    if len(g) != 10 || EdgeCount(g) != 16 {
+        t.Errorf("%d nodes and %d edges, want 10 and 16", len(g), EdgeCount(g))
+    }
+}
+
+func TestIrregularSpacing(t *testing.T) {
+    def := "v1:  v2   v3 \nv2:\tv1\t\tv3\nv3: \t v1 v2\t\n"
+    g, err := ParseGraph(strings.NewReader(def))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    var out bytes.Buffer
+    FprintGraph(&out, g.Nodes)
+    if want := "v1:  v2 v3 \nv2:  v1 v3 \nv3:  v1 v2 \n"; out.String() != want {
+        t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+    }
+    if got := CliqueKeys(FindKCliques(g.Nodes, 3)); reflect.DeepEqual(got, []string{"v1 v2 v3"}) == false {
+        t.Errorf("cliques %q", got)
+    }
+}
+
+func TestSymmetrize(t *testing.T) {
+    // each edge of the triangle is listed by one endpoint only
+    def := "v1: v2\nv2: v3\nv3: v1\n"
+    g, err := ParseGraph(strings.NewReader(def))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    if IsUndirected(g.Nodes) == false {
+        t.Errorf("one-way edges left one-way")
+    }
+    if got := CliqueKeys(FindKCliques(g.Nodes, 3)); reflect.DeepEqual(got, []string{"v1 v2 v3"}) == false {
+        t.Errorf("cliques %q, want the triangle", got)
+    }
+
+    path := filepath.Join(t.TempDir(), "directed.txt")
+    os.WriteFile(path, []byte(def), 0644)
+    parsed, err := ParseGraphFile(path, "colon", ParseOptions{Directed: true})
+    if err != nil {
+        t.Fatalf("ParseGraphFile: %s", err.Error())
+    }
+    if EdgeCount(parsed.Graph) != 3 || IsUndirected(parsed.Graph) {
+        t.Errorf("-directed: edges changed")
+    }
+}
+
+func TestSelfLoops(t *testing.T) {
+    def := "v1: v1 v2 v3\nv2: v1 v3\nv3: v3 v1 v2\n"
+    g, err := ParseGraph(strings.NewReader(def))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    for _, node := range g.Nodes {
+        if node.Degree() != 2 || node.IsConnected(node) {
+            t.Errorf("%s: degree %d, want the self-loop dropped", node.label, node.Degree())
+        }
+    }
+    if got := CliqueKeys(FindKCliques(g.Nodes, 3)); reflect.DeepEqual(got, []string{"v1 v2 v3"}) == false {
+        t.Errorf("cliques %q, want the triangle once", got)
+    }
+
+    path := filepath.Join(t.TempDir(), "loops.txt")
+    os.WriteFile(path, []byte(def), 0644)
+    parsed, err := ParseGraphFile(path, "colon", ParseOptions{AllowSelfLoops: true})
+    if err != nil {
+        t.Fatalf("ParseGraphFile: %s", err.Error())
+    }
+    if v1 := GetNode(parsed.Graph, "v1"); v1.IsConnected(v1) == false {
+        t.Errorf("-allow-self-loops: v1's self-loop dropped")
+    }
+}
+
+func TestRepeatedNeighbors(t *testing.T) {
+    g, err := ParseGraph(strings.NewReader("v1: v2 v2 v3 v2\nv2: v1 v3\nv3: v1 v1 v2\n"))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    for _, node := range g.Nodes {
+        if node.Degree() != 2 {
+            t.Errorf("%s: degree %d, want 2", node.label, node.Degree())
+        }
+    }
+    candidates := 0
+    for item := GetCliqueCandidates(3, GetNode(g.Nodes, "v1").neighbors); item != nil; item = item.next {
+        candidates++
+    }
+    if candidates != 1 {
+        t.Errorf("v1: %d candidates, want 1", candidates)
+    }
+}
+
+func TestLongLine(t *testing.T) {
+    // v0's neighbor list is 100 * 5 = 500 characters, past MAX_LINE_LEN
+    var labels []string
+    var def strings.Builder
+    for i := 0; i < 100; i++ {
+        labels = append(labels, fmt.Sprintf("n%03d", i))
+    }
+    def.WriteString("v0: " + strings.Join(labels, " ") + "\n")
+    for _, label := range labels {
+        def.WriteString(label + ": v0\n")
+    }
+    if len(labels) * 5 <= MAX_LINE_LEN {
+        t.Fatalf("the line fits in MAX_LINE_LEN")
+    }
+    g, err := ParseGraph(strings.NewReader(def.String()))
+    if err != nil {
+        t.Fatalf("ParseGraph: %s", err.Error())
+    }
+    v0 := GetNode(g.Nodes, "v0")
+    if v0.Degree() != 100 || v0.neighbors[99].label != "n099" {
+        t.Errorf("v0: degree %d, want all 100 neighbors", v0.Degree())
+    }
+    two_pass, err := ParseGraphDefTwoPass(strings.NewReader(def.String()), ParseOptions{})
+    if err != nil || GetNode(two_pass.Graph, "v0").Degree() != 100 {
+        t.Errorf("two passes: error %v, want all 100 neighbors", err)
+    }
+}
+
+// failingReader returns data, then err.
+type failingReader struct {
+    data *strings.Reader
+    err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+    n, err := r.data.Read(p)
+    if err == io.EOF {
+        return n, r.err
+    }
+    return n, err
+}
+
+func TestReadError(t *testing.T) {
+    broken := errors.New("connection reset")
+    r := &failingReader{data: strings.NewReader("v1: v2 v3\nv2: v1 v3\n"), err: broken}
+    _, err := ParseGraph(r)
+    if err == nil || strings.Contains(err.Error(), "connection reset") == false {
+        t.Errorf("error %v, want the read error", err)
+    }
+}